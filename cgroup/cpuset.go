@@ -0,0 +1,66 @@
+package cgroup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/elastic/gosigar/util"
+)
+
+// CPUSetSubsystem contains the CPUs and memory nodes that are assigned to a
+// cgroup by the "cpuset" subsystem.
+//
+// https://www.kernel.org/doc/Documentation/cgroup-v1/cpusets.txt
+type CPUSetSubsystem struct {
+	Metadata
+	CPUs          []int `json:"cpus"`           // CPUs the tasks in the cgroup are allowed to use.
+	EffectiveCPUs []int `json:"effective_cpus"` // CPUs actually usable by the tasks (CPUs minus offline CPUs).
+	Mems          []int `json:"mems"`           // Memory nodes the tasks in the cgroup are allowed to use.
+}
+
+// get reads metrics from the "cpuset" subsystem. path is the filepath to the
+// cgroup hierarchy to read.
+func (cpuset *CPUSetSubsystem) get(path string) error {
+	var err error
+	cpuset.CPUs, err = parseListFromFile(path, "cpuset.cpus")
+	if err != nil {
+		return err
+	}
+
+	cpuset.EffectiveCPUs, err = parseListFromFile(path, "cpuset.effective_cpus")
+	if err != nil {
+		return err
+	}
+
+	cpuset.Mems, err = parseListFromFile(path, "cpuset.mems")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NumCPU returns the number of CPUs usable by the tasks in the cgroup. It
+// returns 0 if the number is unknown.
+func (cpuset *CPUSetSubsystem) NumCPU() int {
+	if len(cpuset.EffectiveCPUs) > 0 {
+		return len(cpuset.EffectiveCPUs)
+	}
+	return len(cpuset.CPUs)
+}
+
+// parseListFromFile reads a list of integers written in the kernel's list
+// format (e.g. "0-3,8,10-11") from a file.
+func parseListFromFile(path ...string) ([]int, error) {
+	value, err := ioutil.ReadFile(filepath.Join(path...))
+	if err != nil {
+		// Not all features are implemented/enabled by each OS.
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return util.ParseList(string(value))
+}
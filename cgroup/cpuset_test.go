@@ -0,0 +1,21 @@
+package cgroup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const cpusetPath = "testdata/docker/sys/fs/cgroup/cpuset/docker/b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
+
+func TestCPUSetSubsystemGet(t *testing.T) {
+	cpuset := CPUSetSubsystem{}
+	if err := cpuset.get(cpusetPath); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []int{0, 1, 2, 3}, cpuset.CPUs)
+	assert.Equal(t, []int{0, 1, 2, 3}, cpuset.EffectiveCPUs)
+	assert.Equal(t, []int{0}, cpuset.Mems)
+	assert.Equal(t, 4, cpuset.NumCPU())
+}
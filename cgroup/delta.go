@@ -0,0 +1,214 @@
+package cgroup
+
+import (
+	"errors"
+	"runtime"
+	"time"
+)
+
+// Delta contains rates and ratios derived from two Stats samples of the same
+// cgroup.
+type Delta struct {
+	Metadata
+	// Time that elapsed between the two samples.
+	Elapsed time.Duration `json:"elapsed"`
+	// Reset is true when at least one counter decreased between the two
+	// samples. This happens when the cgroup was recreated, for example when a
+	// container restarts with the same ID. Counters that were reset are
+	// measured from zero.
+	Reset   bool          `json:"reset"`
+	CPU     *CPUDelta     `json:"cpu,omitempty"`
+	BlockIO *BlockIODelta `json:"blkio,omitempty"`
+	Memory  *MemoryDelta  `json:"memory,omitempty"`
+}
+
+// CPUDelta contains the CPU usage and throttling of a cgroup between two
+// samples.
+type CPUDelta struct {
+	// CPU time consumed by tasks in the cgroup during the interval in nanoseconds.
+	UsageNanos uint64 `json:"usage_nanos"`
+	// Usage relative to all host CPUs. 100 means every host CPU was busy.
+	HostPercent float64 `json:"host_pct"`
+	// Usage relative to the CPUs of the cgroup's cpuset. 100 means every CPU
+	// in the cpuset was busy. Zero if the cpuset is unknown, e.g. when the
+	// Reader does not read the cpuset subsystem.
+	CPUSetPercent float64 `json:"cpuset_pct"`
+	// Usage relative to the CFS quota. 100 means the quota was exhausted. Zero
+	// if no quota is set.
+	QuotaPercent float64 `json:"quota_pct"`
+	// Usage of each CPU. 100 means the CPU was busy with tasks of the cgroup
+	// for the whole interval.
+	PerCPUPercent []float64 `json:"percpu_pct,omitempty"`
+	// Fraction of the enforcement periods in the interval during which the
+	// cgroup was throttled, from 0 to 1.
+	ThrottledPeriodsRatio float64 `json:"throttled_periods_ratio"`
+	// Time the cgroup was throttled per second of the interval in nanoseconds.
+	ThrottledNanosPerSec float64 `json:"throttled_nanos_per_sec"`
+}
+
+// BlockIODelta contains the I/O rates of a cgroup between two samples.
+type BlockIODelta struct {
+	Devices          []BlockIODeviceDelta `json:"devices,omitempty"`
+	ReadBytesPerSec  float64              `json:"read_bytes_per_sec"`  // Bytes read per second from all devices.
+	WriteBytesPerSec float64              `json:"write_bytes_per_sec"` // Bytes written per second to all devices.
+	ReadIOPS         float64              `json:"read_iops"`           // Read operations per second on all devices.
+	WriteIOPS        float64              `json:"write_iops"`          // Write operations per second on all devices.
+}
+
+// BlockIODeviceDelta contains the I/O rates of a cgroup on a single device.
+type BlockIODeviceDelta struct {
+	DeviceID         DeviceID `json:"device_id"`
+	ReadBytesPerSec  float64  `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64  `json:"write_bytes_per_sec"`
+	ReadIOPS         float64  `json:"read_iops"`
+	WriteIOPS        float64  `json:"write_iops"`
+}
+
+// MemoryDelta contains the number of times each memory limit of a cgroup was
+// hit between two samples.
+type MemoryDelta struct {
+	MemFailCount       uint64 `json:"mem_failure_count"`
+	MemSwapFailCount   uint64 `json:"memsw_failure_count"`
+	KernelFailCount    uint64 `json:"kmem_failure_count"`
+	KernelTCPFailCount uint64 `json:"kmem_tcp_failure_count"`
+}
+
+// StatsDelta computes the rates and ratios of a cgroup from two samples taken
+// elapsed apart. prev is the older sample. A subsystem is only included in the
+// result when it is present in both samples.
+func StatsDelta(prev, cur *Stats, elapsed time.Duration) (*Delta, error) {
+	if prev == nil || cur == nil {
+		return nil, errors.New("cgroup stats delta requires two samples")
+	}
+	if elapsed <= 0 {
+		return nil, errors.New("cgroup stats delta requires a positive elapsed time")
+	}
+
+	d := &Delta{Metadata: cur.Metadata, Elapsed: elapsed}
+	if cur.CPU != nil && prev.CPU != nil || cur.CPUAccounting != nil && prev.CPUAccounting != nil {
+		d.CPU = cpuDelta(d, prev, cur)
+	}
+	if cur.BlockIO != nil && prev.BlockIO != nil {
+		d.BlockIO = blkioDelta(d, prev.BlockIO, cur.BlockIO)
+	}
+	if cur.Memory != nil && prev.Memory != nil {
+		d.Memory = &MemoryDelta{
+			MemFailCount:       d.counter(prev.Memory.Mem.FailCount, cur.Memory.Mem.FailCount),
+			MemSwapFailCount:   d.counter(prev.Memory.MemSwap.FailCount, cur.Memory.MemSwap.FailCount),
+			KernelFailCount:    d.counter(prev.Memory.Kernel.FailCount, cur.Memory.Kernel.FailCount),
+			KernelTCPFailCount: d.counter(prev.Memory.KernelTCP.FailCount, cur.Memory.KernelTCP.FailCount),
+		}
+	}
+
+	return d, nil
+}
+
+func cpuDelta(d *Delta, prev, cur *Stats) *CPUDelta {
+	cpu := &CPUDelta{}
+	elapsedNanos := float64(d.Elapsed.Nanoseconds())
+
+	if cur.CPUAccounting != nil && prev.CPUAccounting != nil {
+		prevAcct := prev.CPUAccounting
+		if cur.CPUAccounting.TotalNanos < prevAcct.TotalNanos {
+			// All cpuacct counters restarted from zero.
+			d.Reset = true
+			prevAcct = &CPUAccountingSubsystem{}
+		}
+
+		cpu.UsageNanos = cur.CPUAccounting.TotalNanos - prevAcct.TotalNanos
+		// Usage expressed as a number of fully busy CPUs.
+		cores := float64(cpu.UsageNanos) / elapsedNanos
+
+		hostCPUs := len(cur.CPUAccounting.UsagePerCPU)
+		if hostCPUs == 0 {
+			hostCPUs = runtime.NumCPU()
+		}
+		cpu.HostPercent = 100 * cores / float64(hostCPUs)
+
+		if cur.CPUSet != nil && cur.CPUSet.NumCPU() > 0 {
+			cpu.CPUSetPercent = 100 * cores / float64(cur.CPUSet.NumCPU())
+		}
+
+		if cur.CPU != nil && cur.CPU.CFS.QuotaMicros > 0 && cur.CPU.CFS.PeriodMicros > 0 {
+			quotaCores := float64(cur.CPU.CFS.QuotaMicros) / float64(cur.CPU.CFS.PeriodMicros)
+			cpu.QuotaPercent = 100 * cores / quotaCores
+		}
+
+		if len(cur.CPUAccounting.UsagePerCPU) > 0 {
+			cpu.PerCPUPercent = make([]float64, len(cur.CPUAccounting.UsagePerCPU))
+			for i, usage := range cur.CPUAccounting.UsagePerCPU {
+				var prevUsage uint64
+				if i < len(prevAcct.UsagePerCPU) {
+					prevUsage = prevAcct.UsagePerCPU[i]
+				}
+				cpu.PerCPUPercent[i] = 100 * float64(d.counter(prevUsage, usage)) / elapsedNanos
+			}
+		}
+	}
+
+	if cur.CPU != nil && prev.CPU != nil {
+		prevStats := prev.CPU.Stats
+		if cur.CPU.Stats.Periods < prevStats.Periods {
+			// All throttling counters restarted from zero.
+			d.Reset = true
+			prevStats = ThrottleStats{}
+		}
+
+		periods := cur.CPU.Stats.Periods - prevStats.Periods
+		throttledPeriods := d.counter(prevStats.ThrottledPeriods, cur.CPU.Stats.ThrottledPeriods)
+		if periods > 0 {
+			cpu.ThrottledPeriodsRatio = float64(throttledPeriods) / float64(periods)
+		}
+
+		throttledNanos := d.counter(prevStats.ThrottledTimeNanos, cur.CPU.Stats.ThrottledTimeNanos)
+		cpu.ThrottledNanosPerSec = float64(throttledNanos) / d.Elapsed.Seconds()
+	}
+
+	return cpu
+}
+
+func blkioDelta(d *Delta, prev, cur *BlockIOSubsystem) *BlockIODelta {
+	prevDevices := make(map[DeviceID]ThrottleDevice, len(prev.Throttle.Devices))
+	for _, dev := range prev.Throttle.Devices {
+		prevDevices[dev.DeviceID] = dev
+	}
+
+	seconds := d.Elapsed.Seconds()
+	blkio := &BlockIODelta{}
+	for _, dev := range cur.Throttle.Devices {
+		// A device without a previous sample was added since the last
+		// sample, so its counters started from zero.
+		prevDev := prevDevices[dev.DeviceID]
+		if dev.Bytes.Read < prevDev.Bytes.Read || dev.Bytes.Write < prevDev.Bytes.Write ||
+			dev.IOs.Read < prevDev.IOs.Read || dev.IOs.Write < prevDev.IOs.Write {
+			d.Reset = true
+			prevDev = ThrottleDevice{}
+		}
+
+		devDelta := BlockIODeviceDelta{
+			DeviceID:         dev.DeviceID,
+			ReadBytesPerSec:  float64(d.counter(prevDev.Bytes.Read, dev.Bytes.Read)) / seconds,
+			WriteBytesPerSec: float64(d.counter(prevDev.Bytes.Write, dev.Bytes.Write)) / seconds,
+			ReadIOPS:         float64(d.counter(prevDev.IOs.Read, dev.IOs.Read)) / seconds,
+			WriteIOPS:        float64(d.counter(prevDev.IOs.Write, dev.IOs.Write)) / seconds,
+		}
+
+		blkio.Devices = append(blkio.Devices, devDelta)
+		blkio.ReadBytesPerSec += devDelta.ReadBytesPerSec
+		blkio.WriteBytesPerSec += devDelta.WriteBytesPerSec
+		blkio.ReadIOPS += devDelta.ReadIOPS
+		blkio.WriteIOPS += devDelta.WriteIOPS
+	}
+
+	return blkio
+}
+
+// counter returns the increase of a monotonically increasing counter. When
+// the counter decreased it was reset, so the current value is the increase.
+func (d *Delta) counter(prev, cur uint64) uint64 {
+	if cur < prev {
+		d.Reset = true
+		return cur
+	}
+	return cur - prev
+}
@@ -0,0 +1,129 @@
+package cgroup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func deltaTestStats() *Stats {
+	return &Stats{
+		Metadata: Metadata{ID: id, Path: path},
+		CPU: &CPUSubsystem{
+			CFS:   CFS{PeriodMicros: 100000, QuotaMicros: 200000},
+			Stats: ThrottleStats{Periods: 100, ThrottledPeriods: 10, ThrottledTimeNanos: 1000},
+		},
+		CPUAccounting: &CPUAccountingSubsystem{
+			TotalNanos:  4000000000,
+			UsagePerCPU: []uint64{1000000000, 1000000000, 1000000000, 1000000000},
+		},
+		CPUSet: &CPUSetSubsystem{CPUs: []int{0, 1}},
+		Memory: &MemorySubsystem{
+			Mem: MemoryData{FailCount: 3},
+		},
+		BlockIO: &BlockIOSubsystem{
+			Throttle: ThrottlePolicy{
+				Devices: []ThrottleDevice{
+					{
+						DeviceID: DeviceID{253, 1},
+						Bytes:    OperationValues{Read: 4096, Write: 8192},
+						IOs:      OperationValues{Read: 1, Write: 2},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestStatsDelta(t *testing.T) {
+	prev := deltaTestStats()
+	cur := deltaTestStats()
+
+	// One CPU fully busy for 2 seconds.
+	cur.CPUAccounting.TotalNanos += 2000000000
+	cur.CPUAccounting.UsagePerCPU[1] += 2000000000
+	cur.CPU.Stats.Periods += 20
+	cur.CPU.Stats.ThrottledPeriods += 5
+	cur.CPU.Stats.ThrottledTimeNanos += 500000000
+	cur.Memory.Mem.FailCount += 2
+	cur.BlockIO.Throttle.Devices[0].Bytes.Read += 2048
+	cur.BlockIO.Throttle.Devices[0].IOs.Write += 10
+
+	delta, err := StatsDelta(prev, cur, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, id, delta.ID)
+	assert.False(t, delta.Reset)
+
+	if assert.NotNil(t, delta.CPU) {
+		assert.Equal(t, uint64(2000000000), delta.CPU.UsageNanos)
+		assert.InDelta(t, 25, delta.CPU.HostPercent, 0.001)
+		assert.InDelta(t, 50, delta.CPU.CPUSetPercent, 0.001)
+		assert.InDelta(t, 50, delta.CPU.QuotaPercent, 0.001)
+		assert.Equal(t, []float64{0, 100, 0, 0}, delta.CPU.PerCPUPercent)
+		assert.InDelta(t, 0.25, delta.CPU.ThrottledPeriodsRatio, 0.001)
+		assert.InDelta(t, 250000000, delta.CPU.ThrottledNanosPerSec, 0.001)
+	}
+
+	if assert.NotNil(t, delta.Memory) {
+		assert.Equal(t, uint64(2), delta.Memory.MemFailCount)
+	}
+
+	if assert.NotNil(t, delta.BlockIO) && assert.Len(t, delta.BlockIO.Devices, 1) {
+		assert.InDelta(t, 1024, delta.BlockIO.ReadBytesPerSec, 0.001)
+		assert.InDelta(t, 0, delta.BlockIO.WriteBytesPerSec, 0.001)
+		assert.InDelta(t, 5, delta.BlockIO.WriteIOPS, 0.001)
+		assert.Equal(t, DeviceID{253, 1}, delta.BlockIO.Devices[0].DeviceID)
+	}
+}
+
+func TestStatsDeltaCounterReset(t *testing.T) {
+	prev := deltaTestStats()
+
+	// The cgroup was recreated so all counters restarted from zero.
+	cur := deltaTestStats()
+	cur.CPUAccounting.TotalNanos = 1000000000
+	cur.CPUAccounting.UsagePerCPU = []uint64{1000000000, 0, 0, 0}
+	cur.CPU.Stats = ThrottleStats{Periods: 10, ThrottledPeriods: 1, ThrottledTimeNanos: 10}
+	cur.Memory.Mem.FailCount = 1
+
+	delta, err := StatsDelta(prev, cur, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, delta.Reset)
+	assert.Equal(t, uint64(1000000000), delta.CPU.UsageNanos)
+	assert.Equal(t, []float64{100, 0, 0, 0}, delta.CPU.PerCPUPercent)
+	assert.InDelta(t, 0.1, delta.CPU.ThrottledPeriodsRatio, 0.001)
+	assert.Equal(t, uint64(1), delta.Memory.MemFailCount)
+}
+
+func TestStatsDeltaInvalid(t *testing.T) {
+	_, err := StatsDelta(nil, deltaTestStats(), time.Second)
+	assert.Error(t, err)
+
+	_, err = StatsDelta(deltaTestStats(), deltaTestStats(), 0)
+	assert.Error(t, err)
+}
+
+func TestStatsDeltaMissingSubsystems(t *testing.T) {
+	prev := &Stats{CPU: deltaTestStats().CPU}
+	cur := deltaTestStats()
+
+	delta, err := StatsDelta(prev, cur, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the throttling stats are available without cpuacct.
+	if assert.NotNil(t, delta.CPU) {
+		assert.Equal(t, uint64(0), delta.CPU.UsageNanos)
+		assert.Nil(t, delta.CPU.PerCPUPercent)
+	}
+	assert.Nil(t, delta.Memory)
+	assert.Nil(t, delta.BlockIO)
+}
@@ -0,0 +1,100 @@
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DeviceWildcard is the value of DeviceRule.Major and DeviceRule.Minor when
+// the rule matches any major or minor device number (written as "*").
+const DeviceWildcard = -1
+
+// DevicesSubsystem contains the device access allow list of the "devices"
+// subsystem.
+//
+// https://www.kernel.org/doc/Documentation/cgroup-v1/devices.txt
+type DevicesSubsystem struct {
+	Metadata
+	Allow []DeviceRule `json:"allow,omitempty"` // Devices the tasks in the cgroup are allowed to access.
+}
+
+// DeviceRule is a single entry of the devices allow list.
+type DeviceRule struct {
+	Type   string `json:"type"`   // Device type: a (all), b (block) or c (char).
+	Major  int64  `json:"major"`  // Major device number or DeviceWildcard.
+	Minor  int64  `json:"minor"`  // Minor device number or DeviceWildcard.
+	Access string `json:"access"` // Allowed access: a combination of r (read), w (write) and m (mknod).
+}
+
+// get reads the allow list from the "devices" subsystem. path is the filepath
+// to the cgroup hierarchy to read.
+func (devices *DevicesSubsystem) get(path string) error {
+	f, err := os.Open(filepath.Join(path, "devices.list"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	devices.Allow = nil
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+
+		rule, err := parseDeviceRule(line)
+		if err != nil {
+			return err
+		}
+
+		devices.Allow = append(devices.Allow, rule)
+	}
+
+	return sc.Err()
+}
+
+// parseDeviceRule parses a line from devices.list. The format of the line is
+// "type major:minor access" (e.g. "c 1:3 rwm" or "a *:* rwm").
+func parseDeviceRule(line string) (DeviceRule, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return DeviceRule{}, ErrInvalidFormat
+	}
+
+	numbers := strings.SplitN(fields[1], ":", 2)
+	if len(numbers) != 2 {
+		return DeviceRule{}, ErrInvalidFormat
+	}
+
+	major, err := parseDeviceNumber(numbers[0])
+	if err != nil {
+		return DeviceRule{}, fmt.Errorf("invalid major device number in %q: %v", line, err)
+	}
+
+	minor, err := parseDeviceNumber(numbers[1])
+	if err != nil {
+		return DeviceRule{}, fmt.Errorf("invalid minor device number in %q: %v", line, err)
+	}
+
+	return DeviceRule{
+		Type:   fields[0],
+		Major:  major,
+		Minor:  minor,
+		Access: fields[2],
+	}, nil
+}
+
+func parseDeviceNumber(value string) (int64, error) {
+	if value == "*" {
+		return DeviceWildcard, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
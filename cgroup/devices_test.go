@@ -0,0 +1,35 @@
+package cgroup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const devicesPath = "testdata/docker/sys/fs/cgroup/devices/docker/b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
+
+func TestDevicesSubsystemGet(t *testing.T) {
+	devices := DevicesSubsystem{}
+	if err := devices.get(devicesPath); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []DeviceRule{
+		{Type: "c", Major: 1, Minor: 3, Access: "rwm"},
+		{Type: "c", Major: 1, Minor: 5, Access: "rwm"},
+		{Type: "c", Major: 136, Minor: DeviceWildcard, Access: "rwm"},
+		{Type: "b", Major: DeviceWildcard, Minor: DeviceWildcard, Access: "m"},
+	}, devices.Allow)
+}
+
+func TestParseDeviceRule(t *testing.T) {
+	rule, err := parseDeviceRule("a *:* rwm")
+	if assert.NoError(t, err) {
+		assert.Equal(t, DeviceRule{Type: "a", Major: DeviceWildcard, Minor: DeviceWildcard, Access: "rwm"}, rule)
+	}
+
+	for _, line := range []string{"a", "c 1 rwm", "c x:1 rwm", "c 1:y rwm"} {
+		_, err := parseDeviceRule(line)
+		assert.Error(t, err, "line=%q", line)
+	}
+}
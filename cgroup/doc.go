@@ -1,6 +1,7 @@
 // Package cgroup reads metrics and other tunable parameters associated with
 // control groups, a Linux kernel feature for grouping tasks to track and limit
-// resource usage.
+// resource usage. It can also create cgroups, set their limits, and watch for
+// cgroups being created and removed.
 //
 // Terminology
 //
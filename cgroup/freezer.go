@@ -0,0 +1,50 @@
+package cgroup
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Freezer states reported by the "freezer" subsystem.
+const (
+	FreezerThawed   = "THAWED"   // The tasks in the cgroup are running.
+	FreezerFreezing = "FREEZING" // The tasks in the cgroup are in the process of being frozen.
+	FreezerFrozen   = "FROZEN"   // The tasks in the cgroup are frozen.
+)
+
+// FreezerSubsystem contains the state of the "freezer" subsystem, which
+// suspends and resumes the tasks in a cgroup.
+//
+// https://www.kernel.org/doc/Documentation/cgroup-v1/freezer-subsystem.txt
+type FreezerSubsystem struct {
+	Metadata
+	State          string `json:"state"`           // Effective state of the cgroup (THAWED, FREEZING or FROZEN).
+	SelfFreezing   bool   `json:"self_freezing"`   // True if the cgroup itself was requested to be frozen.
+	ParentFreezing bool   `json:"parent_freezing"` // True if the cgroup is frozen because an ancestor is frozen.
+}
+
+// get reads the state from the "freezer" subsystem. path is the filepath to
+// the cgroup hierarchy to read.
+func (freezer *FreezerSubsystem) get(path string) error {
+	state, err := ioutil.ReadFile(filepath.Join(path, "freezer.state"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	freezer.State = string(bytes.TrimSpace(state))
+
+	selfFreezing, err := parseUintFromFile(path, "freezer.self_freezing")
+	if err != nil {
+		return err
+	}
+	freezer.SelfFreezing = selfFreezing == 1
+
+	parentFreezing, err := parseUintFromFile(path, "freezer.parent_freezing")
+	if err != nil {
+		return err
+	}
+	freezer.ParentFreezing = parentFreezing == 1
+
+	return nil
+}
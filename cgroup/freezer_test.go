@@ -0,0 +1,20 @@
+package cgroup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const freezerPath = "testdata/docker/sys/fs/cgroup/freezer/docker/b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
+
+func TestFreezerSubsystemGet(t *testing.T) {
+	freezer := FreezerSubsystem{}
+	if err := freezer.get(freezerPath); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, FreezerFrozen, freezer.State)
+	assert.True(t, freezer.SelfFreezing)
+	assert.False(t, freezer.ParentFreezing)
+}
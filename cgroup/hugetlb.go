@@ -0,0 +1,59 @@
+package cgroup
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// HugeTLBSubsystem contains metrics and limits from the "hugetlb" subsystem.
+// The subsystem accounts for the HugeTLB pages used by the tasks in a cgroup
+// separately for each huge page size supported by the system.
+//
+// https://www.kernel.org/doc/Documentation/cgroup-v1/hugetlb.txt
+type HugeTLBSubsystem struct {
+	Metadata
+	Pages []HugeTLBData `json:"pages,omitempty"` // HugeTLB usage for each huge page size.
+}
+
+// HugeTLBData contains the HugeTLB usage and limit for a single huge page size.
+type HugeTLBData struct {
+	PageSize  string `json:"page_size"`     // Huge page size as written by the kernel (e.g. 2MB, 1GB).
+	Usage     uint64 `json:"usage"`         // Usage in bytes.
+	MaxUsage  uint64 `json:"max_usage"`     // Max usage in bytes.
+	Limit     uint64 `json:"limit"`         // Limit in bytes.
+	FailCount uint64 `json:"failure_count"` // Number of times the limit has been hit.
+}
+
+// get reads metrics from the "hugetlb" subsystem. path is the filepath to the
+// cgroup hierarchy to read.
+func (hugetlb *HugeTLBSubsystem) get(path string) error {
+	// The page sizes are discovered from the limit files that exist for each
+	// supported page size (e.g. hugetlb.2MB.limit_in_bytes).
+	limitFiles, err := filepath.Glob(filepath.Join(path, "hugetlb.*.limit_in_bytes"))
+	if err != nil {
+		return err
+	}
+
+	hugetlb.Pages = nil
+	for _, limitFile := range limitFiles {
+		prefix := strings.TrimSuffix(filepath.Base(limitFile), ".limit_in_bytes")
+
+		data := HugeTLBData{PageSize: strings.TrimPrefix(prefix, "hugetlb.")}
+		if data.Usage, err = parseUintFromFile(path, prefix+".usage_in_bytes"); err != nil {
+			return err
+		}
+		if data.MaxUsage, err = parseUintFromFile(path, prefix+".max_usage_in_bytes"); err != nil {
+			return err
+		}
+		if data.Limit, err = parseUintFromFile(limitFile); err != nil {
+			return err
+		}
+		if data.FailCount, err = parseUintFromFile(path, prefix+".failcnt"); err != nil {
+			return err
+		}
+
+		hugetlb.Pages = append(hugetlb.Pages, data)
+	}
+
+	return nil
+}
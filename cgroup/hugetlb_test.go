@@ -0,0 +1,30 @@
+package cgroup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const hugetlbPath = "testdata/docker/sys/fs/cgroup/hugetlb/docker/b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
+
+func TestHugeTLBSubsystemGet(t *testing.T) {
+	hugetlb := HugeTLBSubsystem{}
+	if err := hugetlb.get(hugetlbPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, hugetlb.Pages, 2) {
+		assert.Equal(t, HugeTLBData{
+			PageSize: "1GB",
+			Limit:    1073741824,
+		}, hugetlb.Pages[0])
+		assert.Equal(t, HugeTLBData{
+			PageSize:  "2MB",
+			Usage:     4194304,
+			MaxUsage:  8388608,
+			Limit:     9223372036854771712,
+			FailCount: 3,
+		}, hugetlb.Pages[1])
+	}
+}
@@ -0,0 +1,65 @@
+package cgroup
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+)
+
+// NetClsSubsystem contains the class identifier that the "net_cls" subsystem
+// tags on the network packets of the tasks in a cgroup.
+//
+// https://www.kernel.org/doc/Documentation/cgroup-v1/net_cls.txt
+type NetClsSubsystem struct {
+	Metadata
+	ClassID uint64 `json:"class_id"` // Class identifier (0xAAAABBBB where AAAA is the major handle and BBBB the minor).
+}
+
+// get reads the class identifier from the "net_cls" subsystem. path is the
+// filepath to the cgroup hierarchy to read.
+func (netCls *NetClsSubsystem) get(path string) error {
+	var err error
+	netCls.ClassID, err = parseUintFromFile(path, "net_cls.classid")
+	return err
+}
+
+// NetPrioSubsystem contains the priorities that the "net_prio" subsystem
+// assigns to the network traffic of the tasks in a cgroup.
+//
+// https://www.kernel.org/doc/Documentation/cgroup-v1/netprio.txt
+type NetPrioSubsystem struct {
+	Metadata
+	PrioIdx   uint64            `json:"prioidx"`             // Kernel internal index of the cgroup.
+	IfPrioMap map[string]uint64 `json:"ifpriomap,omitempty"` // Priority by network interface name.
+}
+
+// get reads the priorities from the "net_prio" subsystem. path is the
+// filepath to the cgroup hierarchy to read.
+func (netPrio *NetPrioSubsystem) get(path string) error {
+	var err error
+	netPrio.PrioIdx, err = parseUintFromFile(path, "net_prio.prioidx")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(path, "net_prio.ifpriomap"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	netPrio.IfPrioMap = map[string]uint64{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		iface, prio, err := parseCgroupParamKeyValue(sc.Text())
+		if err != nil {
+			return err
+		}
+		netPrio.IfPrioMap[iface] = prio
+	}
+
+	return sc.Err()
+}
@@ -0,0 +1,31 @@
+package cgroup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	netClsPath  = "testdata/docker/sys/fs/cgroup/net_cls/docker/b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
+	netPrioPath = "testdata/docker/sys/fs/cgroup/net_prio/docker/b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
+)
+
+func TestNetClsSubsystemGet(t *testing.T) {
+	netCls := NetClsSubsystem{}
+	if err := netCls.get(netClsPath); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, uint64(0x100001), netCls.ClassID)
+}
+
+func TestNetPrioSubsystemGet(t *testing.T) {
+	netPrio := NetPrioSubsystem{}
+	if err := netPrio.get(netPrioPath); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, uint64(2), netPrio.PrioIdx)
+	assert.Equal(t, map[string]uint64{"lo": 0, "eth0": 5, "docker0": 0}, netPrio.IfPrioMap)
+}
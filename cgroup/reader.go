@@ -1,22 +1,39 @@
 package cgroup
 
 import (
+	"fmt"
 	"path/filepath"
 )
 
+// readerSubsystems are the subsystems from which the Reader collects metrics.
+var readerSubsystems = []string{
+	"blkio", "cpu", "cpuacct", "cpuset", "devices", "freezer", "hugetlb",
+	"memory", "net_cls", "net_prio",
+}
+
+// defaultReaderSubsystems are the subsystems read when no subsystem is
+// selected in the ReaderOptions.
+var defaultReaderSubsystems = []string{"blkio", "cpu", "cpuacct", "memory"}
+
 // Stats contains metrics and limits from each of the cgroup subsystems.
 type Stats struct {
 	Metadata
 	CPU           *CPUSubsystem           `json:"cpu"`
 	CPUAccounting *CPUAccountingSubsystem `json:"cpuacct"`
+	CPUSet        *CPUSetSubsystem        `json:"cpuset"`
 	Memory        *MemorySubsystem        `json:"memory"`
 	BlockIO       *BlockIOSubsystem       `json:"blkio"`
+	Devices       *DevicesSubsystem       `json:"devices"`
+	Freezer       *FreezerSubsystem       `json:"freezer"`
+	HugeTLB       *HugeTLBSubsystem       `json:"hugetlb"`
+	NetCls        *NetClsSubsystem        `json:"net_cls"`
+	NetPrio       *NetPrioSubsystem       `json:"net_prio"`
 }
 
 // Metadata contains metadata associated with cgroup stats.
 type Metadata struct {
 	ID   string `json:"id,omitempty"`   // ID of the cgroup.
-	Path string `json:"path,omitempty"` // Path to the cgroup relative to the cgroup subsystem's mountpoint.
+	Path string `json:"path,omitempty"` // Path to the cgroup relative to the root of the hierarchy, as listed in /proc/[pid]/cgroup.
 }
 
 type mount struct {
@@ -24,7 +41,7 @@ type mount struct {
 	mountpoint string // Mountpoint of the subsystem (e.g. /cgroup/cpuacct).
 	path       string // Relative path to the cgroup (e.g. /docker/<id>).
 	id         string // ID of the cgroup.
-	fullPath   string // Absolute path to the cgroup. It's the mountpoint joined with the path.
+	fullPath   string // Absolute path to the cgroup. It's the mountpoint joined with the path relative to the mount root.
 }
 
 // Reader reads cgroup metrics and limits.
@@ -32,32 +49,73 @@ type Reader struct {
 	// Mountpoint of the root filesystem. Defaults to / if not set. This can be
 	// useful for example if you mount / as /rootfs inside of a container.
 	rootfsMountpoint  string
-	ignoreRootCgroups bool              // Ignore a cgroup when its path is "/".
-	cgroupMountpoints map[string]string // Mountpoints for each subsystem (e.g. cpu, cpuacct, memory, blkio).
+	ignoreRootCgroups bool                 // Ignore a cgroup when its path is "/".
+	cgroupMounts      map[string]mountinfo // Mounts for each subsystem (e.g. cpu, cpuacct, memory, blkio).
+}
+
+// ReaderOptions holds options for NewReaderOptions.
+type ReaderOptions struct {
+	// Mountpoint of the root filesystem. Defaults to / if not set. This can be
+	// useful for example if you mount / as /rootfs inside of a container.
+	RootfsMountpoint string
+
+	// Ignore a cgroup when its path is "/".
+	IgnoreRootCgroups bool
+
+	// Subsystems from which metrics are collected (e.g. cpu, memory). Defaults
+	// to blkio, cpu, cpuacct and memory if empty. The cpuset, devices,
+	// freezer, hugetlb, net_cls and net_prio subsystems are only read when
+	// selected.
+	Subsystems []string
 }
 
-// NewReader creates and returns a new Reader.
+// NewReader creates and returns a new Reader that collects metrics from the
+// blkio, cpu, cpuacct and memory subsystems.
 func NewReader(rootfsMountpoint string, ignoreRootCgroups bool) (*Reader, error) {
+	return NewReaderOptions(ReaderOptions{
+		RootfsMountpoint:  rootfsMountpoint,
+		IgnoreRootCgroups: ignoreRootCgroups,
+	})
+}
+
+// NewReaderOptions creates and returns a new Reader with the given options.
+func NewReaderOptions(opts ReaderOptions) (*Reader, error) {
+	rootfsMountpoint := opts.RootfsMountpoint
 	if rootfsMountpoint == "" {
 		rootfsMountpoint = "/"
 	}
 
+	selected := defaultReaderSubsystems
+	if len(opts.Subsystems) > 0 {
+		selected = opts.Subsystems
+	}
+
 	// Determine what subsystems are supported by the kernel.
-	subsystems, err := SupportedSubsystems(rootfsMountpoint)
+	supported, err := SupportedSubsystems(rootfsMountpoint)
 	if err != nil {
 		return nil, err
 	}
 
+	subsystems := map[string]struct{}{}
+	for _, subsystem := range selected {
+		if !isReaderSubsystem(subsystem) {
+			return nil, fmt.Errorf("unsupported cgroup subsystem %v", subsystem)
+		}
+		if _, found := supported[subsystem]; found {
+			subsystems[subsystem] = struct{}{}
+		}
+	}
+
 	// Locate the mountpoints of those subsystems.
-	mountpoints, err := SubsystemMountpoints(rootfsMountpoint, subsystems)
+	mounts, err := subsystemMounts(rootfsMountpoint, subsystems)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Reader{
 		rootfsMountpoint:  rootfsMountpoint,
-		ignoreRootCgroups: ignoreRootCgroups,
-		cgroupMountpoints: mountpoints,
+		ignoreRootCgroups: opts.IgnoreRootCgroups,
+		cgroupMounts:      mounts,
 	}, nil
 }
 
@@ -71,7 +129,7 @@ func (r *Reader) GetStatsForProcess(pid int) (*Stats, error) {
 
 	// Build the full path for the subsystems we are interested in.
 	mounts := map[string]mount{}
-	for _, interestedSubsystem := range []string{"blkio", "cpu", "cpuacct", "memory"} {
+	for _, interestedSubsystem := range readerSubsystems {
 		path, found := paths[interestedSubsystem]
 		if !found {
 			continue
@@ -81,17 +139,22 @@ func (r *Reader) GetStatsForProcess(pid int) (*Stats, error) {
 			continue
 		}
 
-		subsystemMount, found := r.cgroupMountpoints[interestedSubsystem]
+		subsystemMount, found := r.cgroupMounts[interestedSubsystem]
 		if !found {
 			continue
 		}
 
+		fullPath, visible := subsystemMount.cgroupDir(path)
+		if !visible {
+			continue
+		}
+
 		mounts[interestedSubsystem] = mount{
 			subsystem:  interestedSubsystem,
-			mountpoint: subsystemMount,
+			mountpoint: subsystemMount.mountpoint,
 			path:       path,
 			id:         filepath.Base(path),
-			fullPath:   filepath.Join(subsystemMount, path),
+			fullPath:   fullPath,
 		}
 	}
 
@@ -125,6 +188,15 @@ func (r *Reader) GetStatsForProcess(pid int) (*Stats, error) {
 		stats.CPUAccounting.Metadata.ID = mount.id
 		stats.CPUAccounting.Metadata.Path = mount.path
 	}
+	if mount, found := mounts["cpuset"]; found {
+		stats.CPUSet = &CPUSetSubsystem{}
+		err := stats.CPUSet.get(mount.fullPath)
+		if err != nil {
+			return nil, err
+		}
+		stats.CPUSet.Metadata.ID = mount.id
+		stats.CPUSet.Metadata.Path = mount.path
+	}
 	if mount, found := mounts["memory"]; found {
 		stats.Memory = &MemorySubsystem{}
 		err := stats.Memory.get(mount.fullPath)
@@ -134,15 +206,72 @@ func (r *Reader) GetStatsForProcess(pid int) (*Stats, error) {
 		stats.Memory.Metadata.ID = mount.id
 		stats.Memory.Metadata.Path = mount.path
 	}
+	if mount, found := mounts["devices"]; found {
+		stats.Devices = &DevicesSubsystem{}
+		err := stats.Devices.get(mount.fullPath)
+		if err != nil {
+			return nil, err
+		}
+		stats.Devices.Metadata.ID = mount.id
+		stats.Devices.Metadata.Path = mount.path
+	}
+	if mount, found := mounts["freezer"]; found {
+		stats.Freezer = &FreezerSubsystem{}
+		err := stats.Freezer.get(mount.fullPath)
+		if err != nil {
+			return nil, err
+		}
+		stats.Freezer.Metadata.ID = mount.id
+		stats.Freezer.Metadata.Path = mount.path
+	}
+	if mount, found := mounts["hugetlb"]; found {
+		stats.HugeTLB = &HugeTLBSubsystem{}
+		err := stats.HugeTLB.get(mount.fullPath)
+		if err != nil {
+			return nil, err
+		}
+		stats.HugeTLB.Metadata.ID = mount.id
+		stats.HugeTLB.Metadata.Path = mount.path
+	}
+	if mount, found := mounts["net_cls"]; found {
+		stats.NetCls = &NetClsSubsystem{}
+		err := stats.NetCls.get(mount.fullPath)
+		if err != nil {
+			return nil, err
+		}
+		stats.NetCls.Metadata.ID = mount.id
+		stats.NetCls.Metadata.Path = mount.path
+	}
+	if mount, found := mounts["net_prio"]; found {
+		stats.NetPrio = &NetPrioSubsystem{}
+		err := stats.NetPrio.get(mount.fullPath)
+		if err != nil {
+			return nil, err
+		}
+		stats.NetPrio.Metadata.ID = mount.id
+		stats.NetPrio.Metadata.Path = mount.path
+	}
 
-	// Return nil if no metrics were collected.
-	if stats.BlockIO == nil && stats.CPU == nil && stats.CPUAccounting == nil && stats.Memory == nil {
+	// Return nil if no metrics were collected. Stats are collected for each
+	// subsystem with a mount.
+	if len(mounts) == 0 {
 		return nil, nil
 	}
 
 	return &stats, nil
 }
 
+// isReaderSubsystem returns true if the Reader can collect metrics from the
+// subsystem.
+func isReaderSubsystem(subsystem string) bool {
+	for _, s := range readerSubsystems {
+		if s == subsystem {
+			return true
+		}
+	}
+	return false
+}
+
 // getCommonCgroupMetadata returns Metadata containing the cgroup path and ID
 // iff all subsystems share a common path and ID. This is common for
 // containerized processes. If there is no common path and ID then the returned
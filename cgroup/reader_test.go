@@ -2,6 +2,9 @@ package cgroup
 
 import (
 	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,8 +15,40 @@ const (
 	id   = "b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
 )
 
+// newDockerRootfs returns a rootfs in which the hierarchies of the docker test
+// data are bind-mounted at their root, as when the cgroup filesystem of the
+// host is mounted in a container, so the cgroups of pid 985 are visible.
+func newDockerRootfs(t testing.TB) string {
+	docker, err := filepath.Abs("testdata/docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subsystems := []string{
+		"blkio", "cpu", "cpuacct", "cpuset", "devices", "freezer",
+		"hugetlb", "memory", "net_cls", "net_prio", "perf_event",
+	}
+	var mountinfo []string
+	for i, subsystem := range subsystems {
+		mountinfo = append(mountinfo, fmt.Sprintf("%d 24 0:%d / %%[1]s/sys/fs/cgroup/%s ro,relatime - cgroup cgroup rw,%s",
+			30+i, 19+i, subsystem, subsystem))
+	}
+
+	rootfs := newTestRootfs(t, mountinfo...)
+	mustWriteFile(t, readTestFile(t, docker, "proc", "cgroups"), rootfs, "proc", "cgroups")
+	mustWriteFile(t, readTestFile(t, docker, "proc", "985", "cgroup"), rootfs, "proc", "985", "cgroup")
+	if err := os.Symlink(filepath.Join(docker, "sys"), filepath.Join(rootfs, "sys")); err != nil {
+		os.RemoveAll(rootfs)
+		t.Fatal(err)
+	}
+	return rootfs
+}
+
 func TestReaderGetStats(t *testing.T) {
-	reader, err := NewReader("testdata/docker", true)
+	rootfs := newDockerRootfs(t)
+	defer os.RemoveAll(rootfs)
+
+	reader, err := NewReader(rootfs, true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -38,6 +73,14 @@ func TestReaderGetStats(t *testing.T) {
 	assert.Equal(t, path, stats.CPUAccounting.Path)
 	assert.Equal(t, path, stats.Memory.Path)
 
+	// The other subsystems are only read when selected.
+	assert.Nil(t, stats.CPUSet)
+	assert.Nil(t, stats.Devices)
+	assert.Nil(t, stats.Freezer)
+	assert.Nil(t, stats.HugeTLB)
+	assert.Nil(t, stats.NetCls)
+	assert.Nil(t, stats.NetPrio)
+
 	json, err := json.MarshalIndent(stats, "", "  ")
 	if err != nil {
 		t.Fatal(err)
@@ -45,3 +88,171 @@ func TestReaderGetStats(t *testing.T) {
 
 	t.Log(string(json))
 }
+
+func TestReaderGetStatsAllSubsystems(t *testing.T) {
+	rootfs := newDockerRootfs(t)
+	defer os.RemoveAll(rootfs)
+
+	reader, err := NewReaderOptions(ReaderOptions{
+		RootfsMountpoint:  rootfs,
+		IgnoreRootCgroups: true,
+		Subsystems:        readerSubsystems,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := reader.GetStatsForProcess(985)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats == nil {
+		t.Fatal("no cgroup stats found")
+	}
+
+	assert.Equal(t, id, stats.ID)
+	assert.Equal(t, id, stats.BlockIO.ID)
+	assert.Equal(t, id, stats.CPU.ID)
+	assert.Equal(t, id, stats.CPUAccounting.ID)
+	assert.Equal(t, id, stats.CPUSet.ID)
+	assert.Equal(t, id, stats.Memory.ID)
+	assert.Equal(t, id, stats.Devices.ID)
+	assert.Equal(t, id, stats.Freezer.ID)
+	assert.Equal(t, id, stats.HugeTLB.ID)
+	assert.Equal(t, id, stats.NetCls.ID)
+	assert.Equal(t, id, stats.NetPrio.ID)
+
+	assert.Equal(t, path, stats.Path)
+	assert.Equal(t, path, stats.CPUSet.Path)
+	assert.Equal(t, path, stats.Devices.Path)
+	assert.Equal(t, path, stats.Freezer.Path)
+	assert.Equal(t, path, stats.HugeTLB.Path)
+	assert.Equal(t, path, stats.NetCls.Path)
+	assert.Equal(t, path, stats.NetPrio.Path)
+
+	assert.Len(t, stats.HugeTLB.Pages, 2)
+	assert.Equal(t, uint64(0x100001), stats.NetCls.ClassID)
+	assert.Equal(t, uint64(2), stats.NetPrio.PrioIdx)
+}
+
+func TestReaderSubsystems(t *testing.T) {
+	rootfs := newDockerRootfs(t)
+	defer os.RemoveAll(rootfs)
+
+	reader, err := NewReaderOptions(ReaderOptions{
+		RootfsMountpoint:  rootfs,
+		IgnoreRootCgroups: true,
+		Subsystems:        []string{"cpu", "freezer"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := reader.GetStatsForProcess(985)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats == nil {
+		t.Fatal("no cgroup stats found")
+	}
+
+	assert.NotNil(t, stats.CPU)
+	assert.NotNil(t, stats.Freezer)
+	assert.Nil(t, stats.CPUAccounting)
+	assert.Nil(t, stats.Memory)
+	assert.Nil(t, stats.BlockIO)
+	assert.Nil(t, stats.Devices)
+
+	_, err = NewReaderOptions(ReaderOptions{
+		RootfsMountpoint: rootfs,
+		Subsystems:       []string{"perf_event"},
+	})
+	assert.Error(t, err)
+}
+
+func TestReaderGetStatsMountRoot(t *testing.T) {
+	// The hierarchies are bind-mounted from the container's own cgroup, as
+	// Docker does, so the cgroup directories are at the mountpoints.
+	rootfs := newTestRootfs(t,
+		"31 24 0:26 "+path+" %[1]s/sys/fs/cgroup/cpu,cpuacct ro,relatime - cgroup cgroup rw,cpu,cpuacct",
+		"32 24 0:27 "+path+" %[1]s/sys/fs/cgroup/memory ro,relatime - cgroup cgroup rw,memory",
+	)
+	defer os.RemoveAll(rootfs)
+
+	mustWriteFile(t, "4:memory:"+path+"\n2:cpu,cpuacct:"+path+"/worker\n", rootfs, "proc", "985", "cgroup")
+	mustWriteFile(t, "512\n", rootfs, "sys/fs/cgroup/cpu,cpuacct/worker/cpu.shares")
+	mustWriteFile(t, "1073741824\n", rootfs, "sys/fs/cgroup/memory/memory.limit_in_bytes")
+
+	reader, err := NewReader(rootfs, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := reader.GetStatsForProcess(985)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats == nil {
+		t.Fatal("no cgroup stats found")
+	}
+
+	assert.Equal(t, path+"/worker", stats.CPU.Path)
+	assert.Equal(t, "worker", stats.CPU.ID)
+	assert.EqualValues(t, 512, stats.CPU.CFS.Shares)
+
+	assert.Equal(t, path, stats.Memory.Path)
+	assert.Equal(t, id, stats.Memory.ID)
+	assert.EqualValues(t, 1073741824, stats.Memory.Mem.Limit)
+}
+
+func TestReaderGetStatsNotVisible(t *testing.T) {
+	// The memory hierarchy is bind-mounted from another container and the
+	// cpu one from the root of a cgroup namespace.
+	rootfs := newTestRootfs(t,
+		"31 24 0:26 / %[1]s/sys/fs/cgroup/cpu,cpuacct ro,relatime - cgroup cgroup rw,cpu,cpuacct",
+		"32 24 0:27 /docker/3fc95ce32f84 %[1]s/sys/fs/cgroup/memory ro,relatime - cgroup cgroup rw,memory",
+	)
+	defer os.RemoveAll(rootfs)
+
+	mustWriteFile(t, "4:memory:"+path+"\n2:cpu,cpuacct:/../system.slice\n", rootfs, "proc", "985", "cgroup")
+
+	reader, err := NewReader(rootfs, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := reader.GetStatsForProcess(985)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, stats)
+
+	mustWriteFile(t, "4:memory:"+path+"\n2:cpu,cpuacct:"+path+"\n", rootfs, "proc", "985", "cgroup")
+	mustWriteFile(t, "512\n", rootfs, "sys/fs/cgroup/cpu,cpuacct"+path+"/cpu.shares")
+
+	stats, err = reader.GetStatsForProcess(985)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats == nil {
+		t.Fatal("no cgroup stats found")
+	}
+
+	assert.EqualValues(t, 512, stats.CPU.CFS.Shares)
+	assert.Nil(t, stats.Memory)
+}
+
+func TestReaderGetStatsOtherContainer(t *testing.T) {
+	// The captured hierarchies are bind-mounted from the cgroup of the
+	// container reading them, which does not contain pid 985.
+	reader, err := NewReader("testdata/docker", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := reader.GetStatsForProcess(985)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, stats)
+}
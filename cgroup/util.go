@@ -19,6 +19,7 @@ var (
 
 // mountinfo represents a subset of the fields containing /proc/[pid]/mountinfo.
 type mountinfo struct {
+	root           string // Pathname of the directory in the filesystem which forms the root of the mount.
 	mountpoint     string
 	filesystemType string
 	superOptions   []string
@@ -85,6 +86,7 @@ func parseMountinfoLine(line string) (mountinfo, error) {
 			"10 fields but got %d from line='%s'", len(fields), line)
 	}
 
+	mount.root = fields[3]
 	mount.mountpoint = fields[4]
 
 	var seperatorIndex int
@@ -149,17 +151,35 @@ func SupportedSubsystems(rootfsMountpoint string) (map[string]struct{}, error) {
 // The returned map contains the subsystem name as a key and the value is the
 // mountpoint.
 func SubsystemMountpoints(rootfsMountpoint string, subsystems map[string]struct{}) (map[string]string, error) {
+	mounts, err := subsystemMounts(rootfsMountpoint, subsystems)
+	if err != nil {
+		return nil, err
+	}
+
+	mountpoints := make(map[string]string, len(mounts))
+	for subsystem, mount := range mounts {
+		mountpoints[subsystem] = mount.mountpoint
+	}
+
+	return mountpoints, nil
+}
+
+// subsystemMounts returns the mount of each of the given subsystems. When a
+// subsystem is mounted more than once the mount exposing the largest part of
+// the hierarchy (the one with the shortest root) is used.
+func subsystemMounts(rootfsMountpoint string, subsystems map[string]struct{}) (map[string]mountinfo, error) {
 	if rootfsMountpoint == "" {
 		rootfsMountpoint = "/"
 	}
 
-	mountinfo, err := os.Open(filepath.Join(rootfsMountpoint, "proc", "self", "mountinfo"))
+	f, err := os.Open(filepath.Join(rootfsMountpoint, "proc", "self", "mountinfo"))
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	mounts := map[string]string{}
-	sc := bufio.NewScanner(mountinfo)
+	mounts := map[string]mountinfo{}
+	sc := bufio.NewScanner(f)
 	for sc.Scan() {
 		// https://www.kernel.org/doc/Documentation/filesystems/proc.txt
 		// Example:
@@ -191,15 +211,97 @@ func SubsystemMountpoints(rootfsMountpoint string, subsystems map[string]struct{
 
 			// Test if option is a subsystem name.
 			if _, found := subsystems[opt]; found {
-				// Add the subsystem mount if it does not already exist.
-				if _, exists := mounts[opt]; !exists {
-					mounts[opt] = mount.mountpoint
+				// Add the subsystem mount if it does not already exist or if
+				// this mount exposes more of the hierarchy.
+				if existing, exists := mounts[opt]; !exists || len(mount.root) < len(existing.root) {
+					mounts[opt] = mount
 				}
 			}
 		}
 	}
 
-	return mounts, nil
+	return mounts, sc.Err()
+}
+
+// unifiedMount returns the mount of the cgroup v2 unified hierarchy. The
+// mountpoint of the returned mount is empty if the unified hierarchy is not
+// mounted.
+func unifiedMount(rootfsMountpoint string) (mountinfo, error) {
+	if rootfsMountpoint == "" {
+		rootfsMountpoint = "/"
+	}
+
+	f, err := os.Open(filepath.Join(rootfsMountpoint, "proc", "self", "mountinfo"))
+	if err != nil {
+		return mountinfo{}, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+
+		mount, err := parseMountinfoLine(line)
+		if err != nil {
+			return mountinfo{}, err
+		}
+
+		if mount.filesystemType == "cgroup2" && strings.HasPrefix(mount.mountpoint, rootfsMountpoint) {
+			return mount, nil
+		}
+	}
+
+	return mountinfo{}, sc.Err()
+}
+
+// cgroupDir returns the absolute path of the directory of a cgroup in the
+// hierarchy of the mount. path is the pathname of the cgroup relative to the
+// root of the hierarchy, as listed in /proc/[pid]/cgroup.
+//
+// A hierarchy can be mounted from a sub-path, for example when it is
+// bind-mounted into a container. In that case the mount root is removed from
+// the beginning of path. It returns false if the cgroup is not visible in the
+// mount, which happens when it belongs to another container.
+func (m mountinfo) cgroupDir(path string) (string, bool) {
+	rel, ok := m.relativePath(path)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(m.mountpoint, rel), true
+}
+
+// relativePath returns path relative to the mount root. It returns false if
+// path is not below the mount root.
+func (m mountinfo) relativePath(path string) (string, bool) {
+	switch {
+	case path == "/.." || strings.HasPrefix(path, "/../"):
+		// Outside of the cgroup namespace of the reader.
+		return "", false
+	case m.root == "" || m.root == "/":
+		return path, true
+	case path == m.root:
+		return "/", true
+	case strings.HasPrefix(path, m.root+"/"):
+		return path[len(m.root):], true
+	default:
+		return "", false
+	}
+}
+
+// hierarchyPath returns the pathname, relative to the root of the hierarchy,
+// of the cgroup whose directory is dir. It is the inverse of cgroupDir.
+func (m mountinfo) hierarchyPath(dir string) string {
+	rel := "/" + strings.TrimPrefix(strings.TrimPrefix(dir, m.mountpoint), "/")
+	if m.root == "" || m.root == "/" {
+		return rel
+	}
+	if rel == "/" {
+		return m.root
+	}
+	return m.root + rel
 }
 
 // ProcessCgroupPaths returns the cgroups to which a process belongs and the
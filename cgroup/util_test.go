@@ -116,6 +116,8 @@ func TestSubsystemMountpoints(t *testing.T) {
 	subsystems["freezer"] = struct{}{}
 	subsystems["hugetlb"] = struct{}{}
 	subsystems["memory"] = struct{}{}
+	subsystems["net_cls"] = struct{}{}
+	subsystems["net_prio"] = struct{}{}
 	subsystems["perf_event"] = struct{}{}
 
 	mountpoints, err := SubsystemMountpoints("testdata/docker", subsystems)
@@ -131,6 +133,8 @@ func TestSubsystemMountpoints(t *testing.T) {
 	assert.Equal(t, "testdata/docker/sys/fs/cgroup/freezer", mountpoints["freezer"])
 	assert.Equal(t, "testdata/docker/sys/fs/cgroup/hugetlb", mountpoints["hugetlb"])
 	assert.Equal(t, "testdata/docker/sys/fs/cgroup/memory", mountpoints["memory"])
+	assert.Equal(t, "testdata/docker/sys/fs/cgroup/net_cls", mountpoints["net_cls"])
+	assert.Equal(t, "testdata/docker/sys/fs/cgroup/net_prio", mountpoints["net_prio"])
 	assert.Equal(t, "testdata/docker/sys/fs/cgroup/perf_event", mountpoints["perf_event"])
 }
 
@@ -147,11 +151,12 @@ func TestProcessCgroupPaths(t *testing.T) {
 	assert.Equal(t, path, paths["cpuset"])
 	assert.Equal(t, path, paths["devices"])
 	assert.Equal(t, path, paths["freezer"])
+	assert.Equal(t, path, paths["hugetlb"])
 	assert.Equal(t, path, paths["memory"])
 	assert.Equal(t, path, paths["net_cls"])
 	assert.Equal(t, path, paths["net_prio"])
 	assert.Equal(t, path, paths["perf_event"])
-	assert.Len(t, paths, 10)
+	assert.Len(t, paths, 11)
 }
 
 func assertContains(t testing.TB, m map[string]struct{}, key string) {
@@ -175,8 +180,45 @@ func TestParseMountinfoLine(t *testing.T) {
 			t.Fatal(err)
 		}
 
+		assert.Equal(t, "/", mount.root)
 		assert.Equal(t, "/sys/fs/cgroup/blkio", mount.mountpoint)
 		assert.Equal(t, "cgroup", mount.filesystemType)
 		assert.Len(t, mount.superOptions, 2)
 	}
 }
+
+func TestMountinfoCgroupDir(t *testing.T) {
+	tests := []struct {
+		root    string
+		path    string
+		dir     string
+		visible bool
+	}{
+		{"/", "/docker/abc", "/sys/fs/cgroup/cpu/docker/abc", true},
+		{"/docker/abc", "/docker/abc", "/sys/fs/cgroup/cpu", true},
+		{"/docker/abc", "/docker/abc/worker", "/sys/fs/cgroup/cpu/worker", true},
+		// Not below the mount root.
+		{"/docker/abc", "/docker/abcd", "", false},
+		{"/docker/abc", "/system.slice", "", false},
+		// Outside of the cgroup namespace.
+		{"/", "/../system.slice", "", false},
+		{"/", "/..", "", false},
+	}
+
+	for _, test := range tests {
+		mount := mountinfo{root: test.root, mountpoint: "/sys/fs/cgroup/cpu"}
+		dir, visible := mount.cgroupDir(test.path)
+		assert.Equal(t, test.dir, dir, "root=%v path=%v", test.root, test.path)
+		assert.Equal(t, test.visible, visible, "root=%v path=%v", test.root, test.path)
+	}
+}
+
+func TestMountinfoHierarchyPath(t *testing.T) {
+	mount := mountinfo{root: "/", mountpoint: "/sys/fs/cgroup/cpu"}
+	assert.Equal(t, "/", mount.hierarchyPath("/sys/fs/cgroup/cpu"))
+	assert.Equal(t, "/docker/abc", mount.hierarchyPath("/sys/fs/cgroup/cpu/docker/abc"))
+
+	mount.root = "/docker/abc"
+	assert.Equal(t, "/docker/abc", mount.hierarchyPath("/sys/fs/cgroup/cpu"))
+	assert.Equal(t, "/docker/abc/worker", mount.hierarchyPath("/sys/fs/cgroup/cpu/worker"))
+}
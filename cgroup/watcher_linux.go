@@ -0,0 +1,497 @@
+package cgroup
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// Events watched on each cgroup directory.
+	watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ONLYDIR
+
+	// Name of the cgroup v2 file that reports whether a cgroup is populated
+	// and frozen.
+	cgroupEventsFile = "cgroup.events"
+)
+
+// ErrOverflow is sent on the Error channel of a Watcher when the inotify event
+// queue overflowed. The Watcher then rescans the hierarchies and sends the
+// events of the cgroups that were created or removed in the meantime.
+var ErrOverflow = errors.New("inotify event queue overflowed")
+
+// CgroupEvent is sent when a cgroup is created or removed.
+type CgroupEvent struct {
+	Metadata
+	Mountpoint string   // Mountpoint of the hierarchy containing the cgroup.
+	Subsystems []string // Subsystems attached to the hierarchy, sorted. Empty for the v2 unified hierarchy.
+}
+
+// CgroupStateEvent is sent when the state reported by the cgroup.events file
+// of a cgroup in the v2 unified hierarchy changes.
+type CgroupStateEvent struct {
+	Metadata
+	Mountpoint string // Mountpoint of the unified hierarchy.
+	Populated  bool   // True if the cgroup or one of its descendants contains live processes.
+	Frozen     bool   // True if the cgroup is frozen.
+}
+
+// hierarchy is a cgroup hierarchy watched by a Watcher.
+type hierarchy struct {
+	mount      mountinfo
+	subsystems []string
+	unified    bool
+}
+
+// watchedDir is a cgroup directory with an inotify watch.
+type watchedDir struct {
+	hierarchy *hierarchy
+	path      string // Absolute path of the directory.
+}
+
+// cgroupState is the content of a cgroup.events file.
+type cgroupState struct {
+	populated bool
+	frozen    bool
+}
+
+// Watcher uses inotify to watch the cgroup hierarchies for the creation and
+// removal of cgroups. On the v2 unified hierarchy it also reports changes to
+// the populated and frozen state of each cgroup.
+type Watcher struct {
+	Created chan *CgroupEvent      // Cgroup creation events are sent on this channel.
+	Removed chan *CgroupEvent      // Cgroup removal events are sent on this channel.
+	State   chan *CgroupStateEvent // Cgroup v2 state changes are sent on this channel.
+	Error   chan error             // Errors are sent on this channel.
+
+	inotify     *os.File               // The inotify file descriptor, used for reading events and adding watches.
+	hierarchies []*hierarchy           // Watched hierarchies, rescanned after an overflow.
+	watches     map[int32]watchedDir   // Watched directories by watch descriptor.
+	states      map[string]cgroupState // Last cgroup.events state by absolute path.
+	done        chan struct{}          // Closed to stop the readEvents() goroutine.
+	closeOnce   sync.Once              // Ensures that Close() only runs once.
+}
+
+// NewWatcher creates a Watcher for all cgroup hierarchies mounted under
+// rootfsMountpoint. rootfsMountpoint has the same meaning as for NewReader.
+func NewWatcher(rootfsMountpoint string) (*Watcher, error) {
+	if rootfsMountpoint == "" {
+		rootfsMountpoint = "/"
+	}
+
+	subsystems, err := SupportedSubsystems(rootfsMountpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts, err := subsystemMounts(rootfsMountpoint, subsystems)
+	if err != nil {
+		return nil, err
+	}
+
+	unified, err := unifiedMount(rootfsMountpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// Several subsystems can share a single hierarchy (e.g. cpu,cpuacct).
+	byMountpoint := map[string]*hierarchy{}
+	var hierarchies []*hierarchy
+	for subsystem, mount := range mounts {
+		h, found := byMountpoint[mount.mountpoint]
+		if !found {
+			h = &hierarchy{mount: mount}
+			byMountpoint[mount.mountpoint] = h
+			hierarchies = append(hierarchies, h)
+		}
+		h.subsystems = append(h.subsystems, subsystem)
+	}
+	for _, h := range hierarchies {
+		sort.Strings(h.subsystems)
+	}
+	sort.Slice(hierarchies, func(i, j int) bool {
+		return hierarchies[i].mount.mountpoint < hierarchies[j].mount.mountpoint
+	})
+	if unified.mountpoint != "" {
+		hierarchies = append(hierarchies, &hierarchy{mount: unified, unified: true})
+	}
+
+	return newWatcher(hierarchies)
+}
+
+func newWatcher(hierarchies []*hierarchy) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	w := &Watcher{
+		Created: make(chan *CgroupEvent),
+		Removed: make(chan *CgroupEvent),
+		State:   make(chan *CgroupStateEvent),
+		Error:   make(chan error),
+		// The file is non-blocking so Close() interrupts a pending read.
+		inotify:     os.NewFile(uintptr(fd), "inotify"),
+		hierarchies: hierarchies,
+		watches:     map[int32]watchedDir{},
+		states:      map[string]cgroupState{},
+		done:        make(chan struct{}),
+	}
+
+	for _, h := range hierarchies {
+		if _, err := w.addWatches(h, h.mount.mountpoint, false); err != nil {
+			w.inotify.Close()
+			return nil, err
+		}
+	}
+
+	go w.readEvents()
+	return w, nil
+}
+
+// Close stops watching the cgroup hierarchies and closes all event channels.
+func (w *Watcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.inotify.Close()
+	})
+	return err
+}
+
+// addWatches watches dir and all cgroups below it. When emit is true a
+// Created event is sent for dir and for each cgroup below it that was not
+// watched yet. Walking the new directories covers cgroups that were created
+// before the watch on their parent was in place. It returns false if the
+// Watcher was closed.
+func (w *Watcher) addWatches(h *hierarchy, dir string, emit bool) (bool, error) {
+	wd, ok, err := w.addWatch(dir)
+	if !ok {
+		return false, nil
+	}
+	if err != nil {
+		if err == syscall.ENOENT {
+			// The cgroup was removed in the meantime.
+			return true, nil
+		}
+		return true, &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	if _, found := w.watches[int32(wd)]; found {
+		// Already watched, so the events for it were sent before.
+		return true, nil
+	}
+	w.watches[int32(wd)] = watchedDir{hierarchy: h, path: dir}
+
+	if h.unified {
+		w.states[dir], _ = readCgroupState(dir)
+	}
+
+	if emit && !w.sendCgroupEvent(w.Created, newCgroupEvent(h, dir)) {
+		return false, nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return true, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		ok, err := w.addWatches(h, filepath.Join(dir, entry.Name()), emit)
+		if !ok || err != nil {
+			return ok, err
+		}
+	}
+
+	return true, nil
+}
+
+// addWatch adds a watch for dir. The descriptor is used through the inotify
+// file, so Close() cannot close it, and the number cannot be reused by another
+// file, while the watch is added. It returns false if the Watcher was closed.
+func (w *Watcher) addWatch(dir string) (int, bool, error) {
+	conn, err := w.inotify.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	var wd int
+	var addErr error
+	err = conn.Control(func(fd uintptr) {
+		wd, addErr = syscall.InotifyAddWatch(int(fd), dir, watchMask)
+	})
+	if err != nil {
+		// Control() only fails once the file is closed.
+		return 0, false, nil
+	}
+	return wd, true, addErr
+}
+
+// readEvents reads inotify events and dispatches them to the event channels.
+func (w *Watcher) readEvents() {
+	defer w.finish()
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.inotify.Read(buf)
+		if err != nil {
+			select {
+			case <-w.done:
+				return
+			default:
+			}
+
+			if !w.sendError(err) {
+				return
+			}
+			continue
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			if !w.handleEvent(event.Wd, event.Mask, name) {
+				return
+			}
+		}
+	}
+}
+
+// handleEvent dispatches a single inotify event. It returns false if the
+// Watcher was closed.
+func (w *Watcher) handleEvent(wd int32, mask uint32, name string) bool {
+	// The overflow event has no watch descriptor.
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		if !w.sendError(ErrOverflow) {
+			return false
+		}
+		return w.rescan()
+	}
+
+	dir, found := w.watches[wd]
+	if !found {
+		return true
+	}
+
+	switch {
+	case mask&syscall.IN_IGNORED != 0:
+		// The watched directory was removed.
+		delete(w.watches, wd)
+		delete(w.states, dir.path)
+
+	case mask&syscall.IN_CREATE != 0 && mask&syscall.IN_ISDIR != 0:
+		ok, err := w.addWatches(dir.hierarchy, filepath.Join(dir.path, name), true)
+		if !ok {
+			return false
+		}
+		if err != nil {
+			return w.sendError(err)
+		}
+
+	case mask&syscall.IN_DELETE != 0 && mask&syscall.IN_ISDIR != 0:
+		return w.sendCgroupEvent(w.Removed, newCgroupEvent(dir.hierarchy, filepath.Join(dir.path, name)))
+
+	case mask&syscall.IN_MODIFY != 0 && name == cgroupEventsFile && dir.hierarchy.unified:
+		return w.updateState(dir)
+	}
+
+	return true
+}
+
+// updateState sends a CgroupStateEvent if the cgroup.events file of dir
+// changed since it was last read. It returns false if the Watcher was closed.
+func (w *Watcher) updateState(dir watchedDir) bool {
+	state, ok := readCgroupState(dir.path)
+	if !ok || state == w.states[dir.path] {
+		return true
+	}
+	w.states[dir.path] = state
+
+	event := &CgroupStateEvent{
+		Metadata:   cgroupMetadata(dir.hierarchy, dir.path),
+		Mountpoint: dir.hierarchy.mount.mountpoint,
+		Populated:  state.populated,
+		Frozen:     state.frozen,
+	}
+	return w.sendStateEvent(event)
+}
+
+// rescan sends the events lost when the inotify queue overflowed: Removed
+// events for the watched cgroups that no longer exist, Created events for the
+// cgroups that are not watched yet and the changed cgroup v2 states. It
+// returns false if the Watcher was closed.
+func (w *Watcher) rescan() bool {
+	// Children are removed before their parents, so they sort last.
+	var removed []int32
+	for wd, dir := range w.watches {
+		if _, err := os.Stat(dir.path); os.IsNotExist(err) {
+			removed = append(removed, wd)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return w.watches[removed[i]].path > w.watches[removed[j]].path
+	})
+	for _, wd := range removed {
+		dir := w.watches[wd]
+		delete(w.watches, wd)
+		delete(w.states, dir.path)
+		if !w.sendCgroupEvent(w.Removed, newCgroupEvent(dir.hierarchy, dir.path)) {
+			return false
+		}
+	}
+
+	watched := make(map[string]watchedDir, len(w.watches))
+	for _, dir := range w.watches {
+		watched[dir.path] = dir
+	}
+	for _, h := range w.hierarchies {
+		ok, err := w.rescanDir(h, h.mount.mountpoint, watched)
+		if !ok {
+			return false
+		}
+		if err != nil && !w.sendError(err) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rescanDir walks the watched directory dir, adding watches for the new
+// cgroups below it. It returns false if the Watcher was closed.
+func (w *Watcher) rescanDir(h *hierarchy, dir string, watched map[string]watchedDir) (bool, error) {
+	if h.unified && !w.updateState(watched[dir]) {
+		return false, nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return true, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		var ok bool
+		if _, found := watched[path]; found {
+			ok, err = w.rescanDir(h, path, watched)
+		} else {
+			ok, err = w.addWatches(h, path, true)
+		}
+		if !ok || err != nil {
+			return ok, err
+		}
+	}
+
+	return true, nil
+}
+
+// sendCgroupEvent sends an event on ch unless the Watcher is closed first. It
+// returns false if the Watcher was closed.
+func (w *Watcher) sendCgroupEvent(ch chan *CgroupEvent, event *CgroupEvent) bool {
+	select {
+	case ch <- event:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// sendStateEvent sends an event on the State channel unless the Watcher is
+// closed first. It returns false if the Watcher was closed.
+func (w *Watcher) sendStateEvent(event *CgroupStateEvent) bool {
+	select {
+	case w.State <- event:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// sendError sends an error on the Error channel unless the Watcher is closed
+// first. It returns false if the Watcher was closed.
+func (w *Watcher) sendError(err error) bool {
+	select {
+	case w.Error <- err:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// finish closes the event channels after the readEvents() goroutine stopped.
+func (w *Watcher) finish() {
+	close(w.Created)
+	close(w.Removed)
+	close(w.State)
+	close(w.Error)
+}
+
+func newCgroupEvent(h *hierarchy, path string) *CgroupEvent {
+	return &CgroupEvent{
+		Metadata:   cgroupMetadata(h, path),
+		Mountpoint: h.mount.mountpoint,
+		Subsystems: h.subsystems,
+	}
+}
+
+// cgroupMetadata returns the Metadata of the cgroup at the given absolute path.
+// The path in the Metadata is relative to the root of the hierarchy like the
+// paths returned by the Reader.
+func cgroupMetadata(h *hierarchy, path string) Metadata {
+	rel := h.mount.hierarchyPath(path)
+	return Metadata{ID: filepath.Base(rel), Path: rel}
+}
+
+// readCgroupState reads the cgroup.events file of a v2 cgroup. It returns
+// false if the file cannot be read or contains no state.
+func readCgroupState(path string) (cgroupState, bool) {
+	var state cgroupState
+
+	f, err := os.Open(filepath.Join(path, cgroupEventsFile))
+	if err != nil {
+		return state, false
+	}
+	defer f.Close()
+
+	var found bool
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		t, v, err := parseCgroupParamKeyValue(sc.Text())
+		if err != nil {
+			continue
+		}
+		switch t {
+		case "populated":
+			state.populated = v == 1
+			found = true
+		case "frozen":
+			state.frozen = v == 1
+			found = true
+		}
+	}
+
+	return state, found
+}
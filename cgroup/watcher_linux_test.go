@@ -0,0 +1,214 @@
+package cgroup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const watcherTimeout = 5 * time.Second
+
+func newTestWatcher(t *testing.T) (*Watcher, string) {
+	root, err := ioutil.TempDir("", "cgroupwatcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpu := filepath.Join(root, "cpu,cpuacct")
+	unified := filepath.Join(root, "unified")
+	for _, dir := range []string{cpu, unified} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := newWatcher([]*hierarchy{
+		{mount: mountinfo{root: "/", mountpoint: cpu}, subsystems: []string{"cpu", "cpuacct"}},
+		{mount: mountinfo{root: "/", mountpoint: unified}, unified: true},
+	})
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatal(err)
+	}
+
+	return w, root
+}
+
+func receiveCgroupEvent(t *testing.T, w *Watcher, ch chan *CgroupEvent) *CgroupEvent {
+	select {
+	case ev := <-ch:
+		return ev
+	case err := <-w.Error:
+		t.Fatal(err)
+	case <-time.After(watcherTimeout):
+		t.Fatal("timeout waiting for cgroup event")
+	}
+	return nil
+}
+
+func TestWatcherCreatedRemoved(t *testing.T) {
+	w, root := newTestWatcher(t)
+	defer os.RemoveAll(root)
+	defer w.Close()
+
+	cgroup := filepath.Join(root, "cpu,cpuacct", "docker", id)
+	if err := os.MkdirAll(cgroup, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := receiveCgroupEvent(t, w, w.Created)
+	assert.Equal(t, "/docker", ev.Path)
+	assert.Equal(t, "docker", ev.ID)
+	assert.Equal(t, []string{"cpu", "cpuacct"}, ev.Subsystems)
+
+	ev = receiveCgroupEvent(t, w, w.Created)
+	assert.Equal(t, path, ev.Path)
+	assert.Equal(t, id, ev.ID)
+	assert.Equal(t, filepath.Join(root, "cpu,cpuacct"), ev.Mountpoint)
+
+	if err := os.Remove(cgroup); err != nil {
+		t.Fatal(err)
+	}
+
+	ev = receiveCgroupEvent(t, w, w.Removed)
+	assert.Equal(t, path, ev.Path)
+	assert.Equal(t, id, ev.ID)
+}
+
+func TestWatcherState(t *testing.T) {
+	w, root := newTestWatcher(t)
+	defer os.RemoveAll(root)
+	defer w.Close()
+
+	cgroup := filepath.Join(root, "unified", "app")
+	if err := os.Mkdir(cgroup, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := receiveCgroupEvent(t, w, w.Created)
+	assert.Equal(t, "/app", ev.Path)
+	assert.Empty(t, ev.Subsystems)
+
+	// Rewrite the file in place like the kernel does.
+	writeEvents := func(content string) {
+		f, err := os.OpenFile(filepath.Join(cgroup, cgroupEventsFile), os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// No transition, so no event is sent.
+	writeEvents("populated 0\nfrozen 0\n")
+	writeEvents("populated 1\nfrozen 0\n")
+
+	select {
+	case ev := <-w.State:
+		assert.Equal(t, "/app", ev.Path)
+		assert.True(t, ev.Populated)
+		assert.False(t, ev.Frozen)
+	case err := <-w.Error:
+		t.Fatal(err)
+	case <-time.After(watcherTimeout):
+		t.Fatal("timeout waiting for state event")
+	}
+}
+
+func TestWatcherOverflow(t *testing.T) {
+	data, err := ioutil.ReadFile("/proc/sys/fs/inotify/max_queued_events")
+	if err != nil {
+		t.Skip(err)
+	}
+	maxEvents, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || maxEvents > 1<<17 {
+		t.Skip("inotify queue too large to overflow")
+	}
+
+	w, root := newTestWatcher(t)
+	defer os.RemoveAll(root)
+	defer w.Close()
+
+	cpu := filepath.Join(root, "cpu,cpuacct")
+	gone := filepath.Join(cpu, "gone")
+	if err := os.Mkdir(gone, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ev := receiveCgroupEvent(t, w, w.Created)
+	assert.Equal(t, "/gone", ev.Path)
+
+	// The watcher blocks on sending this event until it is received.
+	if err := os.Mkdir(filepath.Join(cpu, "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alternate between two files so that the events are not merged.
+	var files []*os.File
+	for _, name := range []string{"a", "b"} {
+		f, err := os.Create(filepath.Join(cpu, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	// Some events may be read before the watcher blocks.
+	for i := 0; i < 2*maxEvents; i++ {
+		if _, err := files[i%2].Write([]byte{'x'}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// These events are lost.
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(cpu, "lost"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ev = receiveCgroupEvent(t, w, w.Created)
+	assert.Equal(t, "/blocker", ev.Path)
+
+	select {
+	case err := <-w.Error:
+		assert.Equal(t, ErrOverflow, err)
+	case <-time.After(watcherTimeout):
+		t.Fatal("timeout waiting for overflow error")
+	}
+
+	ev = receiveCgroupEvent(t, w, w.Removed)
+	assert.Equal(t, "/gone", ev.Path)
+	ev = receiveCgroupEvent(t, w, w.Created)
+	assert.Equal(t, "/lost", ev.Path)
+}
+
+func TestWatcherClose(t *testing.T) {
+	w, root := newTestWatcher(t)
+	defer os.RemoveAll(root)
+
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Close())
+
+	// All channels are closed once the reader stops.
+	select {
+	case _, ok := <-w.Created:
+		assert.False(t, ok)
+	case <-time.After(watcherTimeout):
+		t.Fatal("timeout waiting for channels to be closed")
+	}
+
+	// No watch is added once the inotify descriptor is closed, as its
+	// number may have been reused.
+	ok, err := w.addWatches(w.hierarchies[0], w.hierarchies[0].mount.mountpoint, false)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,411 @@
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// writerSubsystems are the v1 subsystems in which the Writer creates cgroups.
+// Each is mapped to the v2 controller that provides the same resource control.
+var writerSubsystems = map[string]string{
+	"blkio":   "io",
+	"cpu":     "cpu",
+	"cpuacct": "cpu",
+	"memory":  "memory",
+}
+
+// Writer creates and deletes cgroups, places tasks into them, and sets their
+// limits by writing to the cgroup control files. It supports both the
+// per-subsystem hierarchies of cgroup v1 and the unified hierarchy of cgroup
+// v2. When a subsystem is mounted as a v1 hierarchy it takes precedence over
+// the unified hierarchy.
+//
+// Paths given to the Writer are relative to the root of each hierarchy. These
+// are the same paths that the Reader returns in Metadata.
+type Writer struct {
+	cgroupMounts map[string]mountinfo // Mounts for each v1 subsystem (e.g. cpu, cpuacct, memory, blkio).
+	unified      mountinfo            // Mount of the v2 unified hierarchy. The mountpoint is empty if it is not mounted.
+}
+
+// NewWriter creates and returns a new Writer. rootfsMountpoint has the same
+// meaning as for NewReader.
+func NewWriter(rootfsMountpoint string) (*Writer, error) {
+	if rootfsMountpoint == "" {
+		rootfsMountpoint = "/"
+	}
+
+	subsystems, err := SupportedSubsystems(rootfsMountpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts, err := subsystemMounts(rootfsMountpoint, subsystems)
+	if err != nil {
+		return nil, err
+	}
+
+	unified, err := unifiedMount(rootfsMountpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if unified.mountpoint == "" && len(mounts) == 0 {
+		return nil, fmt.Errorf("no cgroup hierarchies are mounted under %v", rootfsMountpoint)
+	}
+
+	return &Writer{
+		cgroupMounts: mounts,
+		unified:      unified,
+	}, nil
+}
+
+// Create creates the cgroup in each hierarchy managed by the Writer. Missing
+// parent cgroups are created too. On the unified hierarchy the controllers
+// are enabled in every parent of the cgroup.
+func (w *Writer) Create(path string) error {
+	unifiedControllers := map[string]struct{}{}
+	for subsystem, controller := range writerSubsystems {
+		if mount, found := w.cgroupMounts[subsystem]; found {
+			dir, err := mountDir(mount, path)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		} else if w.unified.mountpoint != "" {
+			unifiedControllers[controller] = struct{}{}
+		}
+	}
+
+	if len(unifiedControllers) == 0 {
+		return nil
+	}
+
+	dir, err := mountDir(w.unified, path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return w.enableControllers(path, unifiedControllers)
+}
+
+// enableControllers enables the given controllers in the cgroup.subtree_control
+// file of each parent of path in the unified hierarchy. Controllers that are
+// not available in a parent are skipped.
+func (w *Writer) enableControllers(path string, controllers map[string]struct{}) error {
+	if rel, ok := w.unified.relativePath(path); ok {
+		path = rel
+	}
+
+	parent := w.unified.mountpoint
+	for _, elem := range strings.Split(strings.Trim(filepath.Clean(path), "/"), "/") {
+		if elem == "" {
+			break
+		}
+
+		available, err := ioutil.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+		if err != nil {
+			return err
+		}
+
+		var enable []string
+		for _, controller := range strings.Fields(string(available)) {
+			if _, found := controllers[controller]; found {
+				enable = append(enable, "+"+controller)
+			}
+		}
+
+		if len(enable) > 0 {
+			if err := writeControlFile(strings.Join(enable, " "), parent, "cgroup.subtree_control"); err != nil {
+				return err
+			}
+		}
+
+		parent = filepath.Join(parent, elem)
+	}
+
+	return nil
+}
+
+// Delete removes the cgroup from each hierarchy managed by the Writer. The
+// cgroup must not contain any tasks or child cgroups. Hierarchies in which
+// the cgroup does not exist are ignored.
+func (w *Writer) Delete(path string) error {
+	for _, mount := range w.mounts() {
+		dir, err := mountDir(mount, path)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddProcess moves the process and all of its threads into the cgroup in each
+// hierarchy managed by the Writer.
+func (w *Writer) AddProcess(path string, pid int) error {
+	for _, mount := range w.mounts() {
+		dir, err := mountDir(mount, path)
+		if err != nil {
+			return err
+		}
+		if err := writeControlFile(strconv.Itoa(pid), dir, "cgroup.procs"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetCPUShares sets the relative share of CPU time available to the tasks in
+// the cgroup. On the unified hierarchy the shares are converted to the
+// equivalent cpu.weight.
+func (w *Writer) SetCPUShares(path string, shares uint64) error {
+	dir, unified, err := w.cgroupDir("cpu", path)
+	if err != nil {
+		return err
+	}
+
+	if unified {
+		return writeControlFile(formatUint(sharesToWeight(shares)), dir, "cpu.weight")
+	}
+	return writeControlFile(formatUint(shares), dir, "cpu.shares")
+}
+
+// SetCPUWeight sets the relative weight, from 1 to 10000, of the CPU time
+// available to the tasks in the cgroup. On v1 hierarchies the weight is
+// converted to the equivalent cpu.shares.
+func (w *Writer) SetCPUWeight(path string, weight uint64) error {
+	dir, unified, err := w.cgroupDir("cpu", path)
+	if err != nil {
+		return err
+	}
+
+	if unified {
+		return writeControlFile(formatUint(weight), dir, "cpu.weight")
+	}
+	return writeControlFile(formatUint(weightToShares(weight)), dir, "cpu.shares")
+}
+
+// SetCFSQuota sets the total amount of CPU time in microseconds that the tasks
+// in the cgroup can use during each period. A quota of zero removes the limit.
+// A period of zero leaves the current period unchanged.
+func (w *Writer) SetCFSQuota(path string, quotaMicros, periodMicros uint64) error {
+	dir, unified, err := w.cgroupDir("cpu", path)
+	if err != nil {
+		return err
+	}
+
+	if unified {
+		value := formatLimit(quotaMicros)
+		if periodMicros > 0 {
+			value += " " + formatUint(periodMicros)
+		}
+		return writeControlFile(value, dir, "cpu.max")
+	}
+
+	if periodMicros > 0 {
+		if err := writeControlFile(formatUint(periodMicros), dir, "cpu.cfs_period_us"); err != nil {
+			return err
+		}
+	}
+
+	quota := "-1"
+	if quotaMicros > 0 {
+		quota = formatUint(quotaMicros)
+	}
+	return writeControlFile(quota, dir, "cpu.cfs_quota_us")
+}
+
+// SetMemoryLimit sets the hard limit in bytes of the memory used by the tasks
+// in the cgroup. A limit of zero removes the limit.
+func (w *Writer) SetMemoryLimit(path string, bytes uint64) error {
+	dir, unified, err := w.cgroupDir("memory", path)
+	if err != nil {
+		return err
+	}
+
+	if unified {
+		return writeControlFile(formatLimit(bytes), dir, "memory.max")
+	}
+
+	limit := "-1"
+	if bytes > 0 {
+		limit = formatUint(bytes)
+	}
+	return writeControlFile(limit, dir, "memory.limit_in_bytes")
+}
+
+// SetMemoryHigh sets the memory usage in bytes above which the tasks in the
+// cgroup are throttled and put under heavy reclaim pressure. On v1 hierarchies
+// this sets the soft limit. A value of zero removes the limit.
+func (w *Writer) SetMemoryHigh(path string, bytes uint64) error {
+	dir, unified, err := w.cgroupDir("memory", path)
+	if err != nil {
+		return err
+	}
+
+	if unified {
+		return writeControlFile(formatLimit(bytes), dir, "memory.high")
+	}
+
+	limit := "-1"
+	if bytes > 0 {
+		limit = formatUint(bytes)
+	}
+	return writeControlFile(limit, dir, "memory.soft_limit_in_bytes")
+}
+
+// SetBlockIOThrottle sets the upper I/O limits of the tasks in the cgroup for
+// the device identified by dev.DeviceID. Only the limit fields of dev are
+// used. A limit of zero removes that limit.
+func (w *Writer) SetBlockIOThrottle(path string, dev ThrottleDevice) error {
+	dir, unified, err := w.cgroupDir("blkio", path)
+	if err != nil {
+		return err
+	}
+
+	device := fmt.Sprintf("%d:%d", dev.DeviceID.Major, dev.DeviceID.Minor)
+	if unified {
+		value := fmt.Sprintf("%v rbps=%v wbps=%v riops=%v wiops=%v", device,
+			formatLimit(dev.ReadLimitBPS), formatLimit(dev.WriteLimitBPS),
+			formatLimit(dev.ReadLimitIOPS), formatLimit(dev.WriteLimitIOPS))
+		return writeControlFile(value, dir, "io.max")
+	}
+
+	limits := []struct {
+		file  string
+		value uint64
+	}{
+		{"blkio.throttle.read_bps_device", dev.ReadLimitBPS},
+		{"blkio.throttle.write_bps_device", dev.WriteLimitBPS},
+		{"blkio.throttle.read_iops_device", dev.ReadLimitIOPS},
+		{"blkio.throttle.write_iops_device", dev.WriteLimitIOPS},
+	}
+	for _, limit := range limits {
+		// Writing a value of 0 removes the device's rule.
+		if err := writeControlFile(device+" "+formatUint(limit.value), dir, limit.file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cgroupDir returns the directory of the cgroup in the hierarchy that controls
+// the given v1 subsystem and whether that is the v2 unified hierarchy.
+func (w *Writer) cgroupDir(subsystem, path string) (string, bool, error) {
+	if mount, found := w.cgroupMounts[subsystem]; found {
+		dir, err := mountDir(mount, path)
+		return dir, false, err
+	}
+
+	if w.unified.mountpoint != "" {
+		dir, err := mountDir(w.unified, path)
+		return dir, true, err
+	}
+
+	return "", false, fmt.Errorf("cgroup subsystem %v is not mounted", subsystem)
+}
+
+// mountDir returns the directory of the cgroup in the hierarchy of the mount.
+// It returns an error if the cgroup is not visible in the mount.
+func mountDir(mount mountinfo, path string) (string, error) {
+	dir, visible := mount.cgroupDir(path)
+	if !visible {
+		return "", fmt.Errorf("cgroup %v is not visible in the mount at %v", path, mount.mountpoint)
+	}
+	return dir, nil
+}
+
+// mounts returns the distinct mounts of the hierarchies in which the Writer
+// creates cgroups.
+func (w *Writer) mounts() []mountinfo {
+	var mounts []mountinfo
+	seen := map[string]struct{}{}
+	add := func(mount mountinfo) {
+		if _, found := seen[mount.mountpoint]; !found {
+			seen[mount.mountpoint] = struct{}{}
+			mounts = append(mounts, mount)
+		}
+	}
+
+	var useUnified bool
+	for subsystem := range writerSubsystems {
+		if mount, found := w.cgroupMounts[subsystem]; found {
+			add(mount)
+		} else if w.unified.mountpoint != "" {
+			useUnified = true
+		}
+	}
+	if useUnified {
+		add(w.unified)
+	}
+
+	return mounts
+}
+
+// writeControlFile writes a value to a cgroup control file. The file must
+// already exist because the kernel creates all control files when a cgroup
+// is created.
+func writeControlFile(value string, path ...string) error {
+	f, err := os.OpenFile(filepath.Join(path...), os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %q to %v: %v", value, filepath.Join(path...), err)
+	}
+
+	return nil
+}
+
+func formatUint(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
+
+// formatLimit formats a cgroup v2 limit value where zero means no limit.
+func formatLimit(v uint64) string {
+	if v == 0 {
+		return "max"
+	}
+	return formatUint(v)
+}
+
+// sharesToWeight converts cpu.shares, ranging from 2 to 262144, to the
+// cpu.weight range of 1 to 10000.
+func sharesToWeight(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	} else if shares > 262144 {
+		shares = 262144
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
+// weightToShares converts cpu.weight, ranging from 1 to 10000, to the
+// cpu.shares range of 2 to 262144.
+func weightToShares(weight uint64) uint64 {
+	if weight < 1 {
+		weight = 1
+	} else if weight > 10000 {
+		weight = 10000
+	}
+	return 2 + ((weight-1)*262142)/9999
+}
@@ -0,0 +1,228 @@
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRootfs creates a root filesystem in a temporary directory with the
+// given mountinfo lines. Each %[1]s in a line is replaced with the path of the
+// root filesystem.
+func newTestRootfs(t testing.TB, mountinfo ...string) string {
+	rootfs, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info string
+	for _, line := range mountinfo {
+		info += fmt.Sprintf(line, rootfs) + "\n"
+	}
+
+	cgroups := "#subsys_name\thierarchy\tnum_cgroups\tenabled\n" +
+		"cpu\t2\t1\t1\ncpuacct\t2\t1\t1\nblkio\t3\t1\t1\nmemory\t4\t1\t1\n"
+
+	mustWriteFile(t, info, rootfs, "proc", "self", "mountinfo")
+	mustWriteFile(t, cgroups, rootfs, "proc", "cgroups")
+	return rootfs
+}
+
+func mustWriteFile(t testing.TB, content string, path ...string) {
+	file := filepath.Join(path...)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t testing.TB, path ...string) string {
+	content, err := ioutil.ReadFile(filepath.Join(path...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestWriterV1(t *testing.T) {
+	rootfs := newTestRootfs(t,
+		"30 24 0:25 / %[1]s/sys/fs/cgroup/blkio rw,relatime - cgroup cgroup rw,blkio",
+		"31 24 0:26 / %[1]s/sys/fs/cgroup/cpu,cpuacct rw,relatime - cgroup cgroup rw,cpu,cpuacct",
+		"32 24 0:27 / %[1]s/sys/fs/cgroup/memory rw,relatime - cgroup cgroup rw,memory",
+	)
+	defer os.RemoveAll(rootfs)
+
+	w, err := NewWriter(rootfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const cgroup = "/batch/job1"
+	if err := w.Create(cgroup); err != nil {
+		t.Fatal(err)
+	}
+
+	blkio := filepath.Join(rootfs, "sys/fs/cgroup/blkio", cgroup)
+	cpu := filepath.Join(rootfs, "sys/fs/cgroup/cpu,cpuacct", cgroup)
+	memory := filepath.Join(rootfs, "sys/fs/cgroup/memory", cgroup)
+	for _, dir := range []string{blkio, cpu, memory} {
+		if !assert.DirExists(t, dir) {
+			return
+		}
+	}
+
+	// The kernel creates the control files with the cgroup.
+	for _, file := range []string{"cgroup.procs", "cpu.shares", "cpu.cfs_period_us", "cpu.cfs_quota_us"} {
+		mustWriteFile(t, "", cpu, file)
+	}
+	for _, file := range []string{"cgroup.procs", "memory.limit_in_bytes", "memory.soft_limit_in_bytes"} {
+		mustWriteFile(t, "", memory, file)
+	}
+	for _, file := range []string{"cgroup.procs", "blkio.throttle.read_bps_device",
+		"blkio.throttle.write_bps_device", "blkio.throttle.read_iops_device",
+		"blkio.throttle.write_iops_device"} {
+		mustWriteFile(t, "", blkio, file)
+	}
+
+	if assert.NoError(t, w.AddProcess(cgroup, 985)) {
+		assert.Equal(t, "985", readTestFile(t, cpu, "cgroup.procs"))
+		assert.Equal(t, "985", readTestFile(t, memory, "cgroup.procs"))
+		assert.Equal(t, "985", readTestFile(t, blkio, "cgroup.procs"))
+	}
+
+	if assert.NoError(t, w.SetCPUShares(cgroup, 512)) {
+		assert.Equal(t, "512", readTestFile(t, cpu, "cpu.shares"))
+	}
+	if assert.NoError(t, w.SetCPUWeight(cgroup, 100)) {
+		assert.Equal(t, "2597", readTestFile(t, cpu, "cpu.shares"))
+	}
+
+	if assert.NoError(t, w.SetCFSQuota(cgroup, 50000, 100000)) {
+		assert.Equal(t, "100000", readTestFile(t, cpu, "cpu.cfs_period_us"))
+		assert.Equal(t, "50000", readTestFile(t, cpu, "cpu.cfs_quota_us"))
+	}
+	if assert.NoError(t, w.SetCFSQuota(cgroup, 0, 0)) {
+		assert.Equal(t, "-1", readTestFile(t, cpu, "cpu.cfs_quota_us"))
+	}
+
+	if assert.NoError(t, w.SetMemoryLimit(cgroup, 1<<30)) {
+		assert.Equal(t, "1073741824", readTestFile(t, memory, "memory.limit_in_bytes"))
+	}
+	if assert.NoError(t, w.SetMemoryHigh(cgroup, 0)) {
+		assert.Equal(t, "-1", readTestFile(t, memory, "memory.soft_limit_in_bytes"))
+	}
+
+	dev := ThrottleDevice{DeviceID: DeviceID{8, 0}, ReadLimitBPS: 1048576, WriteLimitIOPS: 100}
+	if assert.NoError(t, w.SetBlockIOThrottle(cgroup, dev)) {
+		assert.Equal(t, "8:0 1048576", readTestFile(t, blkio, "blkio.throttle.read_bps_device"))
+		assert.Equal(t, "8:0 0", readTestFile(t, blkio, "blkio.throttle.write_bps_device"))
+		assert.Equal(t, "8:0 0", readTestFile(t, blkio, "blkio.throttle.read_iops_device"))
+		assert.Equal(t, "8:0 100", readTestFile(t, blkio, "blkio.throttle.write_iops_device"))
+	}
+
+	// Deleting an empty cgroup removes it from every hierarchy.
+	const empty = "/batch/job2"
+	if assert.NoError(t, w.Create(empty)) && assert.NoError(t, w.Delete(empty)) {
+		assert.NoDirExists(t, filepath.Join(rootfs, "sys/fs/cgroup/blkio", empty))
+		assert.NoDirExists(t, filepath.Join(rootfs, "sys/fs/cgroup/cpu,cpuacct", empty))
+		assert.NoDirExists(t, filepath.Join(rootfs, "sys/fs/cgroup/memory", empty))
+	}
+}
+
+func TestWriterV2(t *testing.T) {
+	rootfs := newTestRootfs(t,
+		"30 24 0:25 / %[1]s/sys/fs/cgroup rw,relatime - cgroup2 cgroup2 rw",
+	)
+	defer os.RemoveAll(rootfs)
+
+	unified := filepath.Join(rootfs, "sys/fs/cgroup")
+	mustWriteFile(t, "cpuset cpu io memory pids\n", unified, "cgroup.controllers")
+	mustWriteFile(t, "", unified, "cgroup.subtree_control")
+	mustWriteFile(t, "cpu io memory pids\n", unified, "batch", "cgroup.controllers")
+	mustWriteFile(t, "", unified, "batch", "cgroup.subtree_control")
+
+	w, err := NewWriter(rootfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const cgroup = "/batch/job1"
+	if err := w.Create(cgroup); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "+cpu +io +memory", readTestFile(t, unified, "cgroup.subtree_control"))
+	assert.Equal(t, "+cpu +io +memory", readTestFile(t, unified, "batch", "cgroup.subtree_control"))
+
+	job := filepath.Join(unified, cgroup)
+	for _, file := range []string{"cgroup.procs", "cpu.weight", "cpu.max", "memory.max", "memory.high", "io.max"} {
+		mustWriteFile(t, "", job, file)
+	}
+
+	if assert.NoError(t, w.AddProcess(cgroup, 985)) {
+		assert.Equal(t, "985", readTestFile(t, job, "cgroup.procs"))
+	}
+
+	if assert.NoError(t, w.SetCPUShares(cgroup, 1024)) {
+		assert.Equal(t, "39", readTestFile(t, job, "cpu.weight"))
+	}
+	if assert.NoError(t, w.SetCPUWeight(cgroup, 200)) {
+		assert.Equal(t, "200", readTestFile(t, job, "cpu.weight"))
+	}
+
+	if assert.NoError(t, w.SetCFSQuota(cgroup, 50000, 100000)) {
+		assert.Equal(t, "50000 100000", readTestFile(t, job, "cpu.max"))
+	}
+	if assert.NoError(t, w.SetCFSQuota(cgroup, 0, 0)) {
+		assert.Equal(t, "max", readTestFile(t, job, "cpu.max"))
+	}
+
+	if assert.NoError(t, w.SetMemoryLimit(cgroup, 0)) {
+		assert.Equal(t, "max", readTestFile(t, job, "memory.max"))
+	}
+	if assert.NoError(t, w.SetMemoryHigh(cgroup, 1<<20)) {
+		assert.Equal(t, "1048576", readTestFile(t, job, "memory.high"))
+	}
+
+	dev := ThrottleDevice{DeviceID: DeviceID{8, 0}, ReadLimitBPS: 1048576, WriteLimitIOPS: 100}
+	if assert.NoError(t, w.SetBlockIOThrottle(cgroup, dev)) {
+		assert.Equal(t, "8:0 rbps=1048576 wbps=max riops=max wiops=100", readTestFile(t, job, "io.max"))
+	}
+}
+
+func TestWriterNotMounted(t *testing.T) {
+	rootfs := newTestRootfs(t,
+		"30 24 0:25 / %[1]s/sys/fs/cgroup/blkio rw,relatime - cgroup cgroup rw,blkio",
+	)
+	defer os.RemoveAll(rootfs)
+
+	w, err := NewWriter(rootfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Error(t, w.SetCPUShares("/batch", 1024))
+	assert.Error(t, w.SetMemoryLimit("/batch", 1024))
+}
+
+func TestWriterNotVisible(t *testing.T) {
+	rootfs := newTestRootfs(t,
+		"30 24 0:25 /docker/abc %[1]s/sys/fs/cgroup/blkio rw,relatime - cgroup cgroup rw,blkio",
+	)
+	defer os.RemoveAll(rootfs)
+
+	w, err := NewWriter(rootfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Error(t, w.Create("/docker/def"))
+	assert.Error(t, w.AddProcess("/docker/def", 985))
+	assert.NoError(t, w.Create("/docker/abc/worker"))
+	assert.DirExists(t, filepath.Join(rootfs, "sys/fs/cgroup/blkio/worker"))
+}
@@ -1,36 +1,73 @@
 package gosigar
 
 import (
+	"context"
+	"sync"
 	"time"
 )
 
-type ConcreteSigar struct{}
+// Options holds the filesystem roots read by a Sigar created with NewSigar.
+// Empty roots default to the paths of the host. They are used on Linux,
+// e.g. to read the /proc of a host mounted at /hostfs/proc in a container.
+// If EtcRoot is set, the user and group names of ProcState are read from
+// its passwd and group files, otherwise they are looked up with os/user.
+type Options struct {
+	ProcRoot string // Mountpoint of procfs, defaults to Procd
+	SysRoot  string // Mountpoint of sysfs, defaults to /sys
+	EtcRoot  string // Directory of the mount table (mtab), passwd and group, defaults to /etc
+	DevRoot  string // Directory of the device files, defaults to /dev
+}
+
+var _ Sigar = &ConcreteSigar{}
+
+// ConcreteSigar implements Sigar. The zero value reads the paths of the
+// host, as the Get methods of the types do. Multiple instances with
+// different roots can be used concurrently.
+type ConcreteSigar struct {
+	procRoot string
+	sysRoot  string
+	etcRoot  string
+	devRoot  string
+
+	btime     uint64 // Boot time read from procRoot
+	btimeOnce sync.Once
+}
 
+// NewSigar returns a Sigar reading from the filesystem roots of opts.
+func NewSigar(opts Options) *ConcreteSigar {
+	return &ConcreteSigar{
+		procRoot: opts.ProcRoot,
+		sysRoot:  opts.SysRoot,
+		etcRoot:  opts.EtcRoot,
+		devRoot:  opts.DevRoot,
+	}
+}
+
+// CollectCpuStats sends the CPU usage since the previous sample on the
+// returned channel at each collection interval, the first value being the
+// usage since boot. Samples are dropped while the consumer is busy and samples
+// with errors are skipped. A send on the stop channel stops the collection.
 func (c *ConcreteSigar) CollectCpuStats(collectionInterval time.Duration) (<-chan Cpu, chan<- struct{}) {
 	// samplesCh is buffered to 1 value to immediately return first CPU sample
 	samplesCh := make(chan Cpu, 1)
 
 	stopCh := make(chan struct{})
 
-	go func() {
-		var cpuUsage Cpu
+	ctx, cancel := context.WithCancel(context.Background())
+	samples := c.CollectCpuStatsContext(ctx, collectionInterval, CollectCpuStatsOptions{})
 
-		// Immediately provide non-delta value.
-		// samplesCh is buffered to 1 value, so it will not block.
-		cpuUsage.Get()
-		samplesCh <- cpuUsage
-
-		ticker := time.NewTicker(collectionInterval)
+	go func() {
+		defer cancel()
 
 		for {
 			select {
-			case <-ticker.C:
-				previousCpuUsage := cpuUsage
-
-				cpuUsage.Get()
+			case sample := <-samples:
+				if sample.Err != nil {
+					continue
+				}
 
 				select {
-				case samplesCh <- cpuUsage.Delta(previousCpuUsage):
+				case samplesCh <- sample.Delta:
 				default:
 					// Include default to avoid channel blocking
 				}
@@ -44,21 +81,119 @@ func (c *ConcreteSigar) CollectCpuStats(collectionInterval time.Duration) (<-cha
 	return samplesCh, stopCh
 }
 
+// CollectCpuStatsOptions holds options for CollectCpuStatsContext.
+type CollectCpuStatsOptions struct {
+	// Also collect the usage of each CPU in CpuSample.PerCPU.
+	PerCPU bool
+
+	// Wait for the consumer to receive each sample. By default samples are
+	// dropped while the consumer is busy, the next sample then covers the
+	// time since the last sent one.
+	Block bool
+}
+
+// CpuSample is sent by CollectCpuStatsContext.
+type CpuSample struct {
+	Time    time.Time     // Time the usage was read
+	Elapsed time.Duration // Time since the previous sample, 0 for the first sample
+	Delta   Cpu           // Usage since the previous sample, or since boot for the first sample
+	PerCPU  []Cpu         // Usage of each CPU, like Delta, if CollectCpuStatsOptions.PerCPU is set, nil if the number of CPUs changed
+	Err     error         // Error reading the usage, the other fields are then only Time
+}
+
+// CollectCpuStatsContext sends CPU usage samples on the returned channel at
+// each interval until ctx is cancelled, when the channel is closed. The
+// first sample is available immediately and holds the usage since boot.
+func (c *ConcreteSigar) CollectCpuStatsContext(ctx context.Context, interval time.Duration, opts CollectCpuStatsOptions) <-chan CpuSample {
+	// buffered to 1 value to immediately return the first sample
+	samplesCh := make(chan CpuSample, 1)
+
+	go func() {
+		defer close(samplesCh)
+
+		var prev *CpuSample // Last sent sample, with the usage totals
+		var prevCpus []Cpu
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sample := CpuSample{Time: time.Now()}
+			cpu := Cpu{}
+			cpus := CpuList{}
+
+			sample.Err = cpu.get(c)
+			if sample.Err == nil && opts.PerCPU {
+				sample.Err = cpus.get(c)
+			}
+
+			if sample.Err == nil {
+				sample.Delta = cpu
+				if prev == nil {
+					sample.PerCPU = cpus.List
+				} else {
+					sample.Elapsed = sample.Time.Sub(prev.Time)
+					sample.Delta = cpu.Delta(prev.Delta)
+					// the CPUs can't be matched after a hotplug, the
+					// next sample is relative to this one again
+					if len(cpus.List) == len(prevCpus) {
+						sample.PerCPU = make([]Cpu, len(cpus.List))
+						for i := range cpus.List {
+							sample.PerCPU[i] = cpus.List[i].Delta(prevCpus[i])
+						}
+					}
+				}
+			}
+
+			sent := false
+			if opts.Block {
+				select {
+				case samplesCh <- sample:
+					sent = true
+				case <-ctx.Done():
+					return
+				}
+			} else {
+				select {
+				case samplesCh <- sample:
+					sent = true
+				default:
+					// Include default to avoid channel blocking
+				}
+			}
+
+			// the next delta covers the time since the last sent sample
+			if sent && sample.Err == nil {
+				prev = &CpuSample{Time: sample.Time, Delta: cpu}
+				prevCpus = cpus.List
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return samplesCh
+}
+
 func (c *ConcreteSigar) GetLoadAverage() (LoadAverage, error) {
 	l := LoadAverage{}
-	err := l.Get()
+	err := l.get(c)
 	return l, err
 }
 
 func (c *ConcreteSigar) GetMem() (Mem, error) {
 	m := Mem{}
-	err := m.Get()
+	err := m.get(c)
 	return m, err
 }
 
 func (c *ConcreteSigar) GetSwap() (Swap, error) {
 	s := Swap{}
-	err := s.Get()
+	err := s.get(c)
 	return s, err
 }
 
@@ -70,6 +205,84 @@ func (c *ConcreteSigar) GetFileSystemUsage(path string) (FileSystemUsage, error)
 
 func (c *ConcreteSigar) GetFDUsage() (FDUsage, error) {
 	fd := FDUsage{}
-	err := fd.Get()
+	err := fd.get(c)
+	return fd, err
+}
+
+func (c *ConcreteSigar) GetCpuList() (CpuList, error) {
+	cl := CpuList{}
+	err := cl.get(c)
+	return cl, err
+}
+
+func (c *ConcreteSigar) GetUptime() (Uptime, error) {
+	u := Uptime{}
+	err := u.get(c)
+	return u, err
+}
+
+func (c *ConcreteSigar) GetFileSystemList() (FileSystemList, error) {
+	fsl := FileSystemList{}
+	err := fsl.get(c)
+	return fsl, err
+}
+
+func (c *ConcreteSigar) GetProcList() (ProcList, error) {
+	pl := ProcList{}
+	err := pl.get(c)
+	return pl, err
+}
+
+func (c *ConcreteSigar) GetProcState(pid int) (ProcState, error) {
+	ps := ProcState{}
+	err := ps.get(c, pid)
+	return ps, err
+}
+
+func (c *ConcreteSigar) GetProcMem(pid int) (ProcMem, error) {
+	pm := ProcMem{}
+	err := pm.get(c, pid)
+	return pm, err
+}
+
+func (c *ConcreteSigar) GetProcTime(pid int) (ProcTime, error) {
+	pt := ProcTime{}
+	err := pt.get(c, pid)
+	return pt, err
+}
+
+func (c *ConcreteSigar) GetProcArgs(pid int) (ProcArgs, error) {
+	pa := ProcArgs{}
+	err := pa.get(c, pid)
+	return pa, err
+}
+
+func (c *ConcreteSigar) GetProcExe(pid int) (ProcExe, error) {
+	pe := ProcExe{}
+	err := pe.get(c, pid)
+	return pe, err
+}
+
+func (c *ConcreteSigar) GetProcFDUsage(pid int) (ProcFDUsage, error) {
+	fd := ProcFDUsage{}
+	err := fd.get(c, pid)
 	return fd, err
 }
+
+func (c *ConcreteSigar) GetProcIO(pid int) (ProcIO, error) {
+	pio := ProcIO{}
+	err := pio.get(c, pid)
+	return pio, err
+}
+
+func (c *ConcreteSigar) GetProcSched(pid int) (ProcSched, error) {
+	ps := ProcSched{}
+	err := ps.get(c, pid)
+	return ps, err
+}
+
+func (c *ConcreteSigar) GetProcLimits(pid int) (ProcLimits, error) {
+	pl := ProcLimits{}
+	err := pl.get(c, pid)
+	return pl, err
+}
@@ -1,6 +1,7 @@
 package gosigar_test
 
 import (
+	"os"
 	"runtime"
 	"testing"
 	"time"
@@ -87,3 +88,58 @@ func TestConcreteGetFDUsage(t *testing.T) {
 		assert.True(t, fdUsage.Open <= fdUsage.Max)
 	}
 }
+
+func TestConcreteGetProcesses(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+	pids, err := concreteSigar.GetProcList()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, pids.List, os.Getpid())
+
+	state, err := concreteSigar.GetProcState(os.Getpid())
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, state.Name)
+	}
+
+	procTime, err := concreteSigar.GetProcTime(os.Getpid())
+	if assert.NoError(t, err) {
+		assert.True(t, procTime.StartTime > 0)
+	}
+
+	args, err := concreteSigar.GetProcArgs(os.Getpid())
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, args.List)
+	}
+}
+
+func TestConcreteGetProcessSnapshot(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+	snapshot, err := concreteSigar.GetProcessSnapshot(sigar.ProcessSnapshotOptions{
+		Fields:  sigar.ProcFieldState | sigar.ProcFieldTime | sigar.ProcFieldArgs,
+		Workers: 4,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEmpty(t, snapshot.Processes)
+
+	var self *sigar.Process
+	for i, proc := range snapshot.Processes {
+		if i > 0 {
+			assert.True(t, snapshot.Processes[i-1].Pid < proc.Pid, "processes are sorted by pid")
+		}
+		if proc.Pid == os.Getpid() {
+			self = &snapshot.Processes[i]
+		}
+	}
+	if assert.NotNil(t, self) {
+		assert.NotEmpty(t, self.State.Name)
+		assert.Equal(t, os.Getppid(), self.State.Ppid)
+		assert.True(t, self.Time.StartTime > 0)
+		assert.NotEmpty(t, self.Args.List)
+		// not selected
+		assert.Empty(t, self.Exe.Name)
+	}
+	assert.NotContains(t, snapshot.Errors, os.Getpid())
+}
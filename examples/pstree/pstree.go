@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/elastic/gosigar"
+)
+
+// Prints the process tree, or the subtree of the pid given as argument
+// followed by the resources it uses.
+func main() {
+	pid := 0
+	if len(os.Args) > 1 {
+		var err error
+		if pid, err = strconv.Atoi(os.Args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid pid %q\n", os.Args[1])
+			os.Exit(1)
+		}
+	}
+
+	concreteSigar := &gosigar.ConcreteSigar{}
+	snapshot, err := concreteSigar.GetProcessSnapshot(gosigar.ProcessSnapshotOptions{
+		Fields: gosigar.ProcFieldState | gosigar.ProcFieldMem | gosigar.ProcFieldTime | gosigar.ProcFieldFDUsage,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list processes: %v\n", err)
+		os.Exit(1)
+	}
+
+	tree := gosigar.NewProcTree(snapshot)
+	tree.Render(os.Stdout, pid)
+
+	if pid != 0 {
+		rollup := tree.Rollup(pid)
+		fmt.Printf("\n%d processes, RSS %d kB, CPU %s, %d open files\n",
+			rollup.Processes, rollup.Resident/1024,
+			(&gosigar.ProcTime{Total: rollup.Total}).FormatTotal(), rollup.OpenFDs)
+	}
+}
@@ -1,11 +1,29 @@
 package fakes
 
 import (
+	"sort"
+	"syscall"
 	"time"
 
 	sigar "github.com/elastic/gosigar"
 )
 
+var _ sigar.Sigar = &FakeSigar{}
+
+// FakeProc holds the values returned for a pid of FakeSigar.Procs.
+type FakeProc struct {
+	State   sigar.ProcState
+	Mem     sigar.ProcMem
+	Time    sigar.ProcTime
+	Args    sigar.ProcArgs
+	Exe     sigar.ProcExe
+	FDUsage sigar.ProcFDUsage
+	IO      sigar.ProcIO
+	Sched   sigar.ProcSched
+	Limits  sigar.ProcLimits
+	Err     error // Returned by all the process getters for this pid
+}
+
 type FakeSigar struct {
 	LoadAverage    sigar.LoadAverage
 	LoadAverageErr error
@@ -20,12 +38,30 @@ type FakeSigar struct {
 	FileSystemUsageErr  error
 	FileSystemUsagePath string
 
+	FDUsage    sigar.FDUsage
+	FDUsageErr error
+
+	CpuList    sigar.CpuList
+	CpuListErr error
+
+	Uptime    sigar.Uptime
+	UptimeErr error
+
+	FileSystemList    sigar.FileSystemList
+	FileSystemListErr error
+
+	// Process table, GetProcList returns its pids in order.
+	// The process getters return syscall.ESRCH for other pids.
+	Procs       map[int]FakeProc
+	ProcListErr error
+
 	CollectCpuStatsCpuCh  chan sigar.Cpu
 	CollectCpuStatsStopCh chan struct{}
 }
 
 func NewFakeSigar() *FakeSigar {
 	return &FakeSigar{
+		Procs:                 make(map[int]FakeProc),
 		CollectCpuStatsCpuCh:  make(chan sigar.Cpu, 1),
 		CollectCpuStatsStopCh: make(chan struct{}),
 	}
@@ -70,3 +106,86 @@ func (f *FakeSigar) GetFileSystemUsage(path string) (sigar.FileSystemUsage, erro
 	f.FileSystemUsagePath = path
 	return f.FileSystemUsage, f.FileSystemUsageErr
 }
+
+func (f *FakeSigar) GetFDUsage() (sigar.FDUsage, error) {
+	return f.FDUsage, f.FDUsageErr
+}
+
+func (f *FakeSigar) GetCpuList() (sigar.CpuList, error) {
+	return f.CpuList, f.CpuListErr
+}
+
+func (f *FakeSigar) GetUptime() (sigar.Uptime, error) {
+	return f.Uptime, f.UptimeErr
+}
+
+func (f *FakeSigar) GetFileSystemList() (sigar.FileSystemList, error) {
+	return f.FileSystemList, f.FileSystemListErr
+}
+
+func (f *FakeSigar) GetProcList() (sigar.ProcList, error) {
+	if f.ProcListErr != nil {
+		return sigar.ProcList{}, f.ProcListErr
+	}
+
+	list := make([]int, 0, len(f.Procs))
+	for pid := range f.Procs {
+		list = append(list, pid)
+	}
+	sort.Ints(list)
+
+	return sigar.ProcList{List: list}, nil
+}
+
+func (f *FakeSigar) proc(pid int) (FakeProc, error) {
+	proc, found := f.Procs[pid]
+	if !found {
+		return FakeProc{}, syscall.ESRCH
+	}
+	return proc, proc.Err
+}
+
+func (f *FakeSigar) GetProcState(pid int) (sigar.ProcState, error) {
+	proc, err := f.proc(pid)
+	return proc.State, err
+}
+
+func (f *FakeSigar) GetProcMem(pid int) (sigar.ProcMem, error) {
+	proc, err := f.proc(pid)
+	return proc.Mem, err
+}
+
+func (f *FakeSigar) GetProcTime(pid int) (sigar.ProcTime, error) {
+	proc, err := f.proc(pid)
+	return proc.Time, err
+}
+
+func (f *FakeSigar) GetProcArgs(pid int) (sigar.ProcArgs, error) {
+	proc, err := f.proc(pid)
+	return proc.Args, err
+}
+
+func (f *FakeSigar) GetProcExe(pid int) (sigar.ProcExe, error) {
+	proc, err := f.proc(pid)
+	return proc.Exe, err
+}
+
+func (f *FakeSigar) GetProcFDUsage(pid int) (sigar.ProcFDUsage, error) {
+	proc, err := f.proc(pid)
+	return proc.FDUsage, err
+}
+
+func (f *FakeSigar) GetProcIO(pid int) (sigar.ProcIO, error) {
+	proc, err := f.proc(pid)
+	return proc.IO, err
+}
+
+func (f *FakeSigar) GetProcSched(pid int) (sigar.ProcSched, error) {
+	proc, err := f.proc(pid)
+	return proc.Sched, err
+}
+
+func (f *FakeSigar) GetProcLimits(pid int) (sigar.ProcLimits, error) {
+	proc, err := f.proc(pid)
+	return proc.Limits, err
+}
@@ -0,0 +1,148 @@
+package gosigar
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProcSample holds the usage of a process during a sampling interval.
+// The rates are zero in the first sample of a process.
+type ProcSample struct {
+	Pid       int
+	StartTime uint64        // Start time in milliseconds since the epoch, as in ProcTime
+	Elapsed   time.Duration // Time since the previous sample of the process
+
+	CPUPercent        float64 // Share of all CPUs, from 0 to 100
+	CPUPercentPerCore float64 // Share of one CPU as shown by top, from 0 to 100 per CPU
+
+	ReadBytesPerSec   float64 // Rate of ProcIO.ReadBytes
+	WriteBytesPerSec  float64 // Rate of ProcIO.WriteBytes
+	MinorFaultsPerSec float64
+	MajorFaultsPerSec float64
+
+	IOErr error // Error reading ProcIO, e.g. for processes of other users
+}
+
+// A process is identified by its pid and start time, so a reused pid is
+// a different process.
+type procKey struct {
+	pid       int
+	startTime uint64
+}
+
+type procCounters struct {
+	time   time.Time
+	cpu    ProcTime
+	mem    ProcMem
+	io     ProcIO
+	ioRead bool // io was read without error
+}
+
+// ProcSampler turns the cumulative counters of processes into rates by
+// comparing each sample with the previous one. Processes that exited
+// are forgotten at the next sample. A ProcSampler is safe for concurrent
+// use, although samples are meant to be taken at a regular interval.
+type ProcSampler struct {
+	sigar  Sigar
+	numCPU int
+
+	mu   sync.Mutex
+	prev map[procKey]procCounters
+	now  func() time.Time
+}
+
+// NewProcSampler returns a ProcSampler reading the processes with s.
+func NewProcSampler(s Sigar) *ProcSampler {
+	numCPU := runtime.NumCPU()
+	if cpus, err := s.GetCpuList(); err == nil && len(cpus.List) > 0 {
+		numCPU = len(cpus.List)
+	}
+
+	return &ProcSampler{
+		sigar:  s,
+		numCPU: numCPU,
+		prev:   make(map[procKey]procCounters),
+		now:    time.Now,
+	}
+}
+
+// Sample reads the counters of all processes and returns their usage since
+// the previous call, sorted by pid. Processes that exit while they are read
+// are left out.
+func (p *ProcSampler) Sample() ([]ProcSample, error) {
+	pids, err := p.sigar.GetProcList()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cur := make(map[procKey]procCounters, len(pids.List))
+	samples := make([]ProcSample, 0, len(pids.List))
+
+	for _, pid := range pids.List {
+		counters := procCounters{time: p.now()}
+
+		counters.cpu, err = p.sigar.GetProcTime(pid)
+		if err != nil {
+			continue
+		}
+		counters.mem, err = p.sigar.GetProcMem(pid)
+		if err != nil {
+			continue
+		}
+		var ioErr error
+		counters.io, ioErr = p.sigar.GetProcIO(pid)
+		counters.ioRead = ioErr == nil
+
+		key := procKey{pid: pid, startTime: counters.cpu.StartTime}
+		cur[key] = counters
+
+		sample := ProcSample{Pid: pid, StartTime: key.startTime, IOErr: ioErr}
+		if prev, found := p.prev[key]; found {
+			sample.setRates(prev, counters, p.numCPU)
+		}
+		samples = append(samples, sample)
+	}
+
+	// the processes that are not in cur have exited
+	p.prev = cur
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Pid < samples[j].Pid
+	})
+
+	return samples, nil
+}
+
+func (sample *ProcSample) setRates(prev, cur procCounters, numCPU int) {
+	sample.Elapsed = cur.time.Sub(prev.time)
+	if sample.Elapsed <= 0 {
+		return
+	}
+	seconds := sample.Elapsed.Seconds()
+
+	// ProcTime is in milliseconds
+	cpu := float64(counterDelta(prev.cpu.Total, cur.cpu.Total)) / 1000
+	sample.CPUPercentPerCore = cpu / seconds * 100
+	sample.CPUPercent = sample.CPUPercentPerCore / float64(numCPU)
+
+	sample.MinorFaultsPerSec = float64(counterDelta(prev.mem.MinorFaults, cur.mem.MinorFaults)) / seconds
+	sample.MajorFaultsPerSec = float64(counterDelta(prev.mem.MajorFaults, cur.mem.MajorFaults)) / seconds
+
+	if prev.ioRead && cur.ioRead {
+		sample.ReadBytesPerSec = float64(counterDelta(prev.io.ReadBytes, cur.io.ReadBytes)) / seconds
+		sample.WriteBytesPerSec = float64(counterDelta(prev.io.WriteBytes, cur.io.WriteBytes)) / seconds
+	}
+}
+
+// Returns the increase of a counter, or zero if it was reset.
+func counterDelta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return 0
+	}
+	return cur - prev
+}
@@ -0,0 +1,83 @@
+package gosigar_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	sigar "github.com/elastic/gosigar"
+	"github.com/elastic/gosigar/fakes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcSampler(t *testing.T) {
+	fake := fakes.NewFakeSigar()
+	fake.CpuList = sigar.CpuList{List: make([]sigar.Cpu, 2)}
+	fake.Procs[1] = fakes.FakeProc{
+		Time: sigar.ProcTime{StartTime: 1000, Total: 100},
+		Mem:  sigar.ProcMem{MinorFaults: 10},
+		IO:   sigar.ProcIO{ReadBytes: 4096},
+	}
+	fake.Procs[2] = fakes.FakeProc{Time: sigar.ProcTime{StartTime: 2000, Total: 500}}
+	fake.Procs[3] = fakes.FakeProc{Time: sigar.ProcTime{StartTime: 3000}}
+
+	sampler := sigar.NewProcSampler(fake)
+
+	samples, err := sampler.Sample()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, samples, 3) {
+		// no rates without a previous sample
+		assert.Equal(t, sigar.ProcSample{Pid: 1, StartTime: 1000}, samples[0])
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	proc := fake.Procs[1]
+	proc.Time.Total += 40
+	proc.Mem.MinorFaults += 5
+	proc.IO.ReadBytes += 8192
+	fake.Procs[1] = proc
+	// pid 2 was reused by a process that used less CPU time
+	fake.Procs[2] = fakes.FakeProc{Time: sigar.ProcTime{StartTime: 2500, Total: 10}}
+	// pid 3 exited and pid 4 is new
+	delete(fake.Procs, 3)
+	fake.Procs[4] = fakes.FakeProc{Time: sigar.ProcTime{StartTime: 4000}}
+
+	samples, err = sampler.Sample()
+	if !assert.NoError(t, err) || !assert.Len(t, samples, 3) {
+		return
+	}
+
+	sample := samples[0]
+	assert.Equal(t, 1, sample.Pid)
+	assert.True(t, sample.Elapsed >= 50*time.Millisecond)
+	seconds := sample.Elapsed.Seconds()
+	assert.InDelta(t, 0.04/seconds*100, sample.CPUPercentPerCore, 0.001)
+	assert.InDelta(t, sample.CPUPercentPerCore/2, sample.CPUPercent, 0.001)
+	assert.InDelta(t, 5/seconds, sample.MinorFaultsPerSec, 0.001)
+	assert.InDelta(t, 8192/seconds, sample.ReadBytesPerSec, 0.001)
+	assert.Zero(t, sample.WriteBytesPerSec)
+
+	assert.Equal(t, sigar.ProcSample{Pid: 2, StartTime: 2500}, samples[1])
+	assert.Equal(t, sigar.ProcSample{Pid: 4, StartTime: 4000}, samples[2])
+}
+
+func TestProcSamplerErrors(t *testing.T) {
+	fake := fakes.NewFakeSigar()
+	sampler := sigar.NewProcSampler(fake)
+
+	fake.Procs[1] = fakes.FakeProc{Time: sigar.ProcTime{StartTime: 1000}}
+	// e.g. a process that exited or can't be read
+	fake.Procs[2] = fakes.FakeProc{Err: syscall.EACCES}
+
+	samples, err := sampler.Sample()
+	if assert.NoError(t, err) && assert.Len(t, samples, 1) {
+		assert.Equal(t, 1, samples[0].Pid)
+	}
+
+	fake.ProcListErr = syscall.EPERM
+	_, err = sampler.Sample()
+	assert.Equal(t, syscall.EPERM, err)
+}
@@ -0,0 +1,127 @@
+package gosigar
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// ProcField selects the fields collected by GetProcessSnapshot.
+type ProcField uint
+
+const (
+	ProcFieldState ProcField = 1 << iota
+	ProcFieldMem
+	ProcFieldTime
+	ProcFieldArgs
+	ProcFieldExe
+	ProcFieldFDUsage
+
+	ProcFieldAll = ProcFieldState | ProcFieldMem | ProcFieldTime | ProcFieldArgs | ProcFieldExe | ProcFieldFDUsage
+)
+
+// ProcessSnapshotOptions holds options for GetProcessSnapshot.
+type ProcessSnapshotOptions struct {
+	Fields  ProcField // Fields to collect, defaults to ProcFieldAll
+	Workers int       // Number of processes read concurrently, defaults to runtime.NumCPU()
+}
+
+// Process holds the fields of a process collected by GetProcessSnapshot.
+// Fields that were not selected or could not be read are zero.
+type Process struct {
+	Pid     int
+	State   ProcState
+	Mem     ProcMem
+	Time    ProcTime
+	Args    ProcArgs
+	Exe     ProcExe
+	FDUsage ProcFDUsage
+}
+
+// ProcessSnapshot holds the processes running when GetProcessSnapshot
+// was called. Processes that exited while they were read are left out.
+type ProcessSnapshot struct {
+	Processes []Process     // Sorted by pid
+	Errors    map[int]error // First error reading each process, e.g. syscall.ESRCH or a permission error
+}
+
+// procLookups caches the lookups shared by the processes of a snapshot,
+// the names of their user and group ids and the device files of their
+// controlling terminals. It is safe for concurrent use.
+type procLookups struct {
+	mu     sync.Mutex
+	users  map[string]ProcID // By uid
+	groups map[string]ProcID // By gid
+
+	etcRoot    string // Names are read from its passwd and group if set
+	etcOnce    sync.Once
+	userNames  map[string]string // By uid, read once from etcRoot/passwd
+	groupNames map[string]string // By gid, read once from etcRoot/group
+
+	devsOnce sync.Once
+	devs     []os.FileInfo // Files of devd(), read once
+}
+
+func newProcLookups(s *ConcreteSigar) *procLookups {
+	return &procLookups{
+		users:   make(map[string]ProcID),
+		groups:  make(map[string]ProcID),
+		etcRoot: s.etcRoot,
+	}
+}
+
+// GetProcessSnapshot reads the selected fields of all processes, reading
+// each proc file once. It only returns an error if the processes can't be
+// listed, the errors of single processes are in ProcessSnapshot.Errors.
+func (c *ConcreteSigar) GetProcessSnapshot(opts ProcessSnapshotOptions) (ProcessSnapshot, error) {
+	pids := ProcList{}
+	if err := pids.get(c); err != nil {
+		return ProcessSnapshot{}, err
+	}
+
+	fields := opts.Fields
+	if fields == 0 {
+		fields = ProcFieldAll
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	procs := make([]*Process, len(pids.List))
+	errs := make([]error, len(pids.List))
+	lookups := newProcLookups(c)
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				procs[i], errs[i] = c.getProcess(pids.List[i], fields, lookups)
+			}
+		}()
+	}
+	for i := range pids.List {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	snapshot := ProcessSnapshot{Errors: make(map[int]error)}
+	for i, pid := range pids.List {
+		if errs[i] != nil {
+			snapshot.Errors[pid] = errs[i]
+		}
+		if procs[i] != nil {
+			snapshot.Processes = append(snapshot.Processes, *procs[i])
+		}
+	}
+	sort.Slice(snapshot.Processes, func(i, j int) bool {
+		return snapshot.Processes[i].Pid < snapshot.Processes[j].Pid
+	})
+
+	return snapshot, nil
+}
@@ -0,0 +1,39 @@
+// +build !freebsd,!linux
+
+package gosigar
+
+import "syscall"
+
+// Reads the fields of a process with the Get methods. Returns a nil Process
+// if it exited, and the first error reading the fields.
+func (s *ConcreteSigar) getProcess(pid int, fields ProcField, lookups *procLookups) (*Process, error) {
+	proc := &Process{Pid: pid}
+	getters := []struct {
+		field ProcField
+		get   func() error
+	}{
+		{ProcFieldState, func() error { return proc.State.get(s, pid) }},
+		{ProcFieldMem, func() error { return proc.Mem.get(s, pid) }},
+		{ProcFieldTime, func() error { return proc.Time.get(s, pid) }},
+		{ProcFieldArgs, func() error { return proc.Args.get(s, pid) }},
+		{ProcFieldExe, func() error { return proc.Exe.get(s, pid) }},
+		{ProcFieldFDUsage, func() error { return proc.FDUsage.get(s, pid) }},
+	}
+
+	var firstErr error
+	for _, getter := range getters {
+		if fields&getter.field == 0 {
+			continue
+		}
+		if err := getter.get(); err != nil {
+			if err == syscall.ESRCH {
+				return nil, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return proc, firstErr
+}
@@ -0,0 +1,198 @@
+package gosigar
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ProcTree is the tree of the processes of a ProcessSnapshot, built from
+// the parent pids of ProcState. The snapshot must include ProcFieldState,
+// and ProcFieldMem, ProcFieldTime and ProcFieldFDUsage for the rollups.
+type ProcTree struct {
+	procs    map[int]*Process
+	children map[int][]int // Pids of the children of each pid, sorted
+	roots    []int         // Pids whose parent is not in the snapshot, sorted
+}
+
+// ProcRollup holds the resources used by a process and its descendants.
+type ProcRollup struct {
+	Processes int    // Number of processes in the subtree
+	Resident  uint64 // Sum of ProcMem.Resident
+	User      uint64 // Sum of ProcTime.User and ProcTime.ChildrenUser, in milliseconds
+	Sys       uint64 // Sum of ProcTime.Sys and ProcTime.ChildrenSys, in milliseconds
+	Total     uint64 // User + Sys
+	OpenFDs   uint64 // Sum of ProcFDUsage.Open
+}
+
+// NewProcTree builds the tree of the processes of snapshot.
+func NewProcTree(snapshot ProcessSnapshot) *ProcTree {
+	t := &ProcTree{
+		procs:    make(map[int]*Process, len(snapshot.Processes)),
+		children: make(map[int][]int),
+	}
+	for i := range snapshot.Processes {
+		proc := &snapshot.Processes[i]
+		t.procs[proc.Pid] = proc
+	}
+
+	for pid, proc := range t.procs {
+		ppid := proc.State.Ppid
+		if _, found := t.procs[ppid]; !found || ppid == pid {
+			t.roots = append(t.roots, pid)
+			continue
+		}
+		t.children[ppid] = append(t.children[ppid], pid)
+	}
+
+	sort.Ints(t.roots)
+	for _, pids := range t.children {
+		sort.Ints(pids)
+	}
+
+	return t
+}
+
+// Get returns the process with the given pid.
+func (t *ProcTree) Get(pid int) (Process, bool) {
+	proc, found := t.procs[pid]
+	if !found {
+		return Process{}, false
+	}
+	return *proc, true
+}
+
+// Roots returns the processes whose parent is not in the tree, e.g. init
+// and kthreadd, sorted by pid.
+func (t *ProcTree) Roots() []Process {
+	return t.list(t.roots)
+}
+
+// Children returns the children of pid, sorted by pid.
+func (t *ProcTree) Children(pid int) []Process {
+	return t.list(t.children[pid])
+}
+
+// Descendants returns the descendants of pid in depth-first order,
+// each process being followed by its own descendants.
+func (t *ProcTree) Descendants(pid int) []Process {
+	var descendants []Process
+	t.walk(pid, func(proc *Process, depth int) {
+		if depth > 0 {
+			descendants = append(descendants, *proc)
+		}
+	})
+	return descendants
+}
+
+// Ancestors returns the ancestors of pid, starting with its parent.
+func (t *ProcTree) Ancestors(pid int) []Process {
+	var ancestors []Process
+	seen := map[int]bool{pid: true}
+
+	proc, found := t.procs[pid]
+	for found {
+		ppid := proc.State.Ppid
+		if seen[ppid] {
+			break
+		}
+		seen[ppid] = true
+
+		proc, found = t.procs[ppid]
+		if found {
+			ancestors = append(ancestors, *proc)
+		}
+	}
+	return ancestors
+}
+
+// Rollup returns the resources used by pid and its descendants, e.g. a
+// server and its workers. The CPU time includes the children that exited
+// and were waited for.
+func (t *ProcTree) Rollup(pid int) ProcRollup {
+	rollup := ProcRollup{}
+	t.walk(pid, func(proc *Process, depth int) {
+		rollup.Processes++
+		rollup.Resident += proc.Mem.Resident
+		rollup.User += proc.Time.User + proc.Time.ChildrenUser
+		rollup.Sys += proc.Time.Sys + proc.Time.ChildrenSys
+		rollup.OpenFDs += proc.FDUsage.Open
+	})
+	rollup.Total = rollup.User + rollup.Sys
+	return rollup
+}
+
+// Render writes the subtree of pid like pstree, one process per line with
+// its pid and name. All the trees are written when pid is zero.
+func (t *ProcTree) Render(w io.Writer, pid int) error {
+	pids := []int{pid}
+	if pid == 0 {
+		pids = t.roots
+	}
+
+	for _, pid := range pids {
+		proc, found := t.procs[pid]
+		if !found {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%d %s\n", proc.Pid, proc.State.Name); err != nil {
+			return err
+		}
+		if err := t.render(w, pid, "", map[int]bool{pid: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *ProcTree) render(w io.Writer, pid int, prefix string, seen map[int]bool) error {
+	children := t.children[pid]
+	for i, child := range children {
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+
+		branch, indent := "├─ ", "│  "
+		if i == len(children)-1 {
+			branch, indent = "└─ ", "   "
+		}
+
+		proc := t.procs[child]
+		if _, err := fmt.Fprintf(w, "%s%s%d %s\n", prefix, branch, proc.Pid, proc.State.Name); err != nil {
+			return err
+		}
+		if err := t.render(w, child, prefix+indent, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Calls fn for pid and its descendants in depth-first order.
+func (t *ProcTree) walk(pid int, fn func(proc *Process, depth int)) {
+	seen := make(map[int]bool)
+
+	var visit func(pid int, depth int)
+	visit = func(pid int, depth int) {
+		proc, found := t.procs[pid]
+		if !found || seen[pid] {
+			return
+		}
+		seen[pid] = true
+
+		fn(proc, depth)
+		for _, child := range t.children[pid] {
+			visit(child, depth+1)
+		}
+	}
+	visit(pid, 0)
+}
+
+func (t *ProcTree) list(pids []int) []Process {
+	procs := make([]Process, 0, len(pids))
+	for _, pid := range pids {
+		procs = append(procs, *t.procs[pid])
+	}
+	return procs
+}
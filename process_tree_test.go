@@ -0,0 +1,82 @@
+package gosigar_test
+
+import (
+	"bytes"
+	"testing"
+
+	sigar "github.com/elastic/gosigar"
+	"github.com/stretchr/testify/assert"
+)
+
+func treeProcess(pid, ppid int, name string, resident, cpu, fds uint64) sigar.Process {
+	return sigar.Process{
+		Pid:     pid,
+		State:   sigar.ProcState{Name: name, Ppid: ppid},
+		Mem:     sigar.ProcMem{Resident: resident},
+		Time:    sigar.ProcTime{User: cpu, Sys: cpu, ChildrenUser: cpu / 10},
+		FDUsage: sigar.ProcFDUsage{Open: fds},
+	}
+}
+
+func TestProcTree(t *testing.T) {
+	tree := sigar.NewProcTree(sigar.ProcessSnapshot{
+		Processes: []sigar.Process{
+			treeProcess(1, 0, "init", 100, 10, 5),
+			treeProcess(2, 0, "kthreadd", 0, 0, 0),
+			treeProcess(10, 1, "nginx", 1000, 100, 10),
+			treeProcess(11, 10, "nginx", 2000, 200, 20),
+			treeProcess(12, 10, "nginx", 3000, 300, 30),
+			treeProcess(20, 1, "sshd", 500, 50, 4),
+			treeProcess(21, 20, "bash", 400, 0, 3),
+		},
+	})
+
+	pids := func(procs []sigar.Process) []int {
+		var pids []int
+		for _, proc := range procs {
+			pids = append(pids, proc.Pid)
+		}
+		return pids
+	}
+
+	assert.Equal(t, []int{1, 2}, pids(tree.Roots()))
+	assert.Equal(t, []int{10, 20}, pids(tree.Children(1)))
+	assert.Empty(t, tree.Children(2))
+	assert.Equal(t, []int{10, 11, 12, 20, 21}, pids(tree.Descendants(1)))
+	assert.Equal(t, []int{20, 1}, pids(tree.Ancestors(21)))
+	assert.Empty(t, tree.Ancestors(1))
+
+	proc, found := tree.Get(11)
+	if assert.True(t, found) {
+		assert.Equal(t, "nginx", proc.State.Name)
+	}
+	_, found = tree.Get(3)
+	assert.False(t, found)
+
+	assert.Equal(t, sigar.ProcRollup{
+		Processes: 3,
+		Resident:  6000,
+		User:      660,
+		Sys:       600,
+		Total:     1260,
+		OpenFDs:   60,
+	}, tree.Rollup(10))
+	assert.Equal(t, sigar.ProcRollup{}, tree.Rollup(3))
+
+	buf := &bytes.Buffer{}
+	if assert.NoError(t, tree.Render(buf, 0)) {
+		assert.Equal(t, `1 init
+├─ 10 nginx
+│  ├─ 11 nginx
+│  └─ 12 nginx
+└─ 20 sshd
+   └─ 21 bash
+2 kthreadd
+`, buf.String())
+	}
+
+	buf.Reset()
+	if assert.NoError(t, tree.Render(buf, 20)) {
+		assert.Equal(t, "20 sshd\n└─ 21 bash\n", buf.String())
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2012 VMware, Inc.
+
+package psnotify
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/gosigar"
+)
+
+// Filters for WatchAll(). They read the state of the process from
+// gosigar.Procd when an event is received. A process that has already been reaped by
+// its parent when its event is handled does not match any filter.
+
+// ParentFilter matches the processes whose parent has the given pid.
+func ParentFilter(ppid int) ProcFilter {
+	return func(pid int) bool {
+		value, err := readProcStatus(pid, "PPid")
+		if err != nil {
+			return false
+		}
+		return value == strconv.Itoa(ppid)
+	}
+}
+
+// UidFilter matches the processes whose real user id is uid.
+func UidFilter(uid int) ProcFilter {
+	return func(pid int) bool {
+		value, err := readProcStatus(pid, "Uid")
+		if err != nil {
+			return false
+		}
+		// Real, effective, saved set and filesystem uids
+		fields := strings.Fields(value)
+		return len(fields) > 0 && fields[0] == strconv.Itoa(uid)
+	}
+}
+
+// CommFilter matches the processes whose command name is comm.
+// The kernel truncates command names to 15 bytes.
+func CommFilter(comm string) ProcFilter {
+	return func(pid int) bool {
+		value, err := ioutil.ReadFile(procFile(pid, "comm"))
+		if err != nil {
+			return false
+		}
+		return string(bytes.TrimSuffix(value, []byte("\n"))) == comm
+	}
+}
+
+// CgroupFilter matches the processes that belong to the cgroup
+// with the given path, or to one of its descendants, in any hierarchy.
+// The path is relative to the root of the hierarchy as listed
+// in /proc/[pid]/cgroup (e.g. /docker/<id>).
+func CgroupFilter(path string) ProcFilter {
+	path = strings.TrimSuffix(path, "/")
+	return func(pid int) bool {
+		f, err := os.Open(procFile(pid, "cgroup"))
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			// Format: hierarchy-ID:subsystem-list:cgroup-path
+			fields := strings.SplitN(sc.Text(), ":", 3)
+			if len(fields) != 3 {
+				continue
+			}
+			cgroup := fields[2]
+			if cgroup == path || strings.HasPrefix(cgroup, path+"/") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Returns the value of a field of /proc/[pid]/status.
+func readProcStatus(pid int, field string) (string, error) {
+	f, err := os.Open(procFile(pid, "status"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	prefix := field + ":"
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(line[len(prefix):]), nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("field %s not found in %s", field, procFile(pid, "status"))
+}
+
+// Returns the path of a file of /proc/[pid] under gosigar.Procd.
+func procFile(pid int, name string) string {
+	return filepath.Join(gosigar.Procd, strconv.Itoa(pid), name)
+}
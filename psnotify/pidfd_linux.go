@@ -0,0 +1,229 @@
+// Copyright (c) 2012 VMware, Inc.
+
+package psnotify
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// linux/wait.h: waitid() idtype for a pidfd
+	pPidfd = 3
+
+	// asm-generic/siginfo.h: SIGCHLD si_codes
+	cldExited = 1
+	cldKilled = 2
+	cldDumped = 3
+)
+
+// asm-generic/siginfo.h: siginfo_t, as filled by waitid().
+// The union of the fields is aligned like a pointer.
+type siginfo struct {
+	Signo  int32
+	Errno  int32
+	Code   int32
+	_      [0]uintptr
+	Pid    int32
+	Uid    uint32
+	Status int32
+	_      [112]byte
+}
+
+// Exit notification of single processes with pidfds, see WatchExit().
+type exitWatcher struct {
+	epfd    int           // The syscall.EpollCreate1() file descriptor
+	file    *os.File      // Non-blocking file wrapping epfd, closed to stop readExits()
+	pidfds  map[int]int   // Map of watched pid to its pidfd
+	pids    map[int]int   // Map of pidfd to its watched pid
+	stopped chan struct{} // Closed when readExits() returns
+}
+
+func pidfdOpen(pid int) (int, error) {
+	fd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// Sets the exit status of a child that was not reaped yet, the
+// status of other processes can't be read through their pidfd.
+func (ev *ProcEventExit) setPidfdStatus(pidfd int) {
+	info := &siginfo{}
+	_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPidfd, uintptr(pidfd),
+		uintptr(unsafe.Pointer(info)), syscall.WEXITED|syscall.WNOHANG|syscall.WNOWAIT, 0, 0)
+	if errno != 0 || info.Pid == 0 {
+		return
+	}
+	ev.StatusKnown = true
+
+	switch info.Code {
+	case cldExited:
+		ev.ExitCode = int(info.Status)
+	case cldKilled:
+		ev.Signal = syscall.Signal(info.Status)
+	case cldDumped:
+		ev.Signal = syscall.Signal(info.Status)
+		ev.CoreDumped = true
+	}
+}
+
+// Watch the exit of pid with a pidfd, or with the event listener on
+// kernels older than 5.3 and where seccomp denies pidfd_open().
+// Must be called with w.mu held.
+func (w *Watcher) registerExit(pid int) error {
+	if w.exits != nil {
+		if _, found := w.exits.pidfds[pid]; found {
+			return nil
+		}
+	}
+
+	pidfd, err := pidfdOpen(pid)
+	if err == syscall.ENOSYS || err == syscall.EPERM {
+		return w.addWatch(pid, PROC_EVENT_EXIT)
+	}
+	if err != nil {
+		return err
+	}
+
+	if w.exits == nil {
+		exits, err := newExitWatcher()
+		if err != nil {
+			syscall.Close(pidfd)
+			return err
+		}
+		w.exits = exits
+		go w.readExits(exits)
+	}
+
+	// the pidfd becomes readable when the process exits
+	event := &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(pidfd)}
+	err = syscall.EpollCtl(w.exits.epfd, syscall.EPOLL_CTL_ADD, pidfd, event)
+	if err != nil {
+		syscall.Close(pidfd)
+		return err
+	}
+
+	w.exits.pidfds[pid] = pidfd
+	w.exits.pids[pidfd] = pid
+
+	return nil
+}
+
+func newExitWatcher() (*exitWatcher, error) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	// non-blocking, so reads are interrupted by closing the file
+	if err := syscall.SetNonblock(epfd, true); err != nil {
+		syscall.Close(epfd)
+		return nil, err
+	}
+
+	return &exitWatcher{
+		epfd:    epfd,
+		file:    os.NewFile(uintptr(epfd), "epoll"),
+		pidfds:  make(map[int]int),
+		pids:    make(map[int]int),
+		stopped: make(chan struct{}),
+	}, nil
+}
+
+// Internal helper to check if the exit of pid is watched with a pidfd.
+func (w *Watcher) isWatchingExit(pid int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.exits == nil {
+		return false
+	}
+	_, found := w.exits.pidfds[pid]
+	return found
+}
+
+// Read the exits of the processes added with WatchExit()
+// until stopExits() closes the epoll instance.
+func (w *Watcher) readExits(exits *exitWatcher) {
+	defer close(exits.stopped)
+
+	conn, err := exits.file.SyscallConn()
+	if err != nil {
+		w.sendError(err)
+		return
+	}
+
+	events := make([]syscall.EpollEvent, 16)
+
+	for {
+		var nr int
+		var waitErr error
+
+		// the callback is called again when the epoll instance is readable
+		err := conn.Read(func(fd uintptr) bool {
+			nr, waitErr = syscall.EpollWait(int(fd), events, 0)
+			return nr > 0 || (waitErr != nil && waitErr != syscall.EINTR)
+		})
+		if err != nil {
+			if w.isDone() {
+				return
+			}
+			w.sendError(err)
+			return
+		}
+		if waitErr != nil {
+			w.sendError(waitErr)
+			continue
+		}
+
+		for _, event := range events[:nr] {
+			pidfd := int(event.Fd)
+
+			w.mu.Lock()
+			pid, found := exits.pids[pidfd]
+			if found {
+				delete(exits.pids, pidfd)
+				delete(exits.pidfds, pid)
+				syscall.EpollCtl(exits.epfd, syscall.EPOLL_CTL_DEL, pidfd, nil)
+				// as done by handleExit(), which skips pids watched here
+				w.removeWatch(pid)
+			}
+			w.mu.Unlock()
+
+			if !found {
+				continue
+			}
+
+			ev := &ProcEventExit{Pid: pid, Tid: pid}
+			ev.setPidfdStatus(pidfd)
+			syscall.Close(pidfd)
+
+			select {
+			case w.Exit <- ev:
+			case <-w.done:
+			}
+		}
+	}
+}
+
+// Stop readExits() and close the remaining pidfds,
+// called before the event channels are closed.
+func (w *Watcher) stopExits() {
+	w.mu.Lock()
+	exits := w.exits
+	w.mu.Unlock()
+
+	if exits == nil {
+		return
+	}
+
+	exits.file.Close()
+	<-exits.stopped
+
+	for pidfd := range exits.pids {
+		syscall.Close(pidfd)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2012 VMware, Inc.
+
+package psnotify
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/gosigar"
+)
+
+// Process attributes compared between two polls of the process list.
+type pollProc struct {
+	startTime uint64 // Start time in milliseconds, tells reused pids apart
+	ppid      int
+	comm      string
+	cmdline   string
+}
+
+// Polling implementation of the eventListener interface, used when the
+// netlink connector is not available. Fork, exec and exit events are
+// synthesised by comparing process list snapshots, so processes that
+// start and exit between two polls are not reported.
+type pollListener struct {
+	interval time.Duration
+	procs    map[int]pollProc // Snapshot of the last poll
+}
+
+func newPollListener(interval time.Duration) (*pollListener, error) {
+	procs, err := readProcs()
+	if err != nil {
+		return nil, err
+	}
+	return &pollListener{interval: interval, procs: procs}, nil
+}
+
+// The pollEvents() loop stops when the watcher is closed.
+func (listener *pollListener) close() error {
+	return nil
+}
+
+// Read a snapshot of the running processes.
+func readProcs() (map[int]pollProc, error) {
+	list := gosigar.ProcList{}
+	if err := list.Get(); err != nil {
+		return nil, err
+	}
+
+	procs := make(map[int]pollProc, len(list.List))
+	for _, pid := range list.List {
+		state := gosigar.ProcState{}
+		ptime := gosigar.ProcTime{}
+		args := gosigar.ProcArgs{}
+
+		// the process exited since the list was read
+		if err := state.Get(pid); err != nil {
+			continue
+		}
+		if err := ptime.Get(pid); err != nil {
+			continue
+		}
+		args.Get(pid)
+
+		procs[pid] = pollProc{
+			startTime: ptime.StartTime,
+			ppid:      state.Ppid,
+			comm:      state.Name,
+			cmdline:   strings.Join(args.List, "\x00"),
+		}
+	}
+
+	return procs, nil
+}
+
+// Poll the process list until the watcher is closed.
+func (w *Watcher) pollEvents(listener *pollListener) {
+	ticker := time.NewTicker(listener.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		procs, err := readProcs()
+		if err != nil {
+			w.sendError(err)
+			continue
+		}
+
+		w.handleSnapshot(listener.procs, procs)
+		listener.procs = procs
+	}
+}
+
+// Dispatch the events found by comparing the previous
+// snapshot with the current one to the Event channels.
+func (w *Watcher) handleSnapshot(prev, cur map[int]pollProc) {
+	var exited, started, execed []int
+	for pid, p := range prev {
+		if c, found := cur[pid]; !found || c.startTime != p.startTime {
+			exited = append(exited, pid)
+		}
+	}
+	for pid, c := range cur {
+		p, found := prev[pid]
+		if !found || c.startTime != p.startTime {
+			started = append(started, pid)
+		} else if c.comm != p.comm || c.cmdline != p.cmdline {
+			execed = append(execed, pid)
+		}
+	}
+
+	sort.Ints(exited)
+	sort.Ints(execed)
+	// parents start before their children, so forks are followed
+	sort.Slice(started, func(i, j int) bool {
+		a, b := cur[started[i]], cur[started[j]]
+		if a.startTime != b.startTime {
+			return a.startTime < b.startTime
+		}
+		return started[i] < started[j]
+	})
+
+	for _, pid := range exited {
+		w.handleExit(&ProcEventExit{Pid: pid, Tid: pid})
+	}
+
+	for _, pid := range started {
+		c := cur[pid]
+		w.handleFork(&ProcEventFork{
+			ParentPid: c.ppid,
+			ParentTid: c.ppid,
+			ChildPid:  pid,
+			ChildTid:  pid,
+		})
+
+		// a child runs the program of its parent until it calls exec()
+		if parent, found := cur[c.ppid]; found && (c.comm != parent.comm || c.cmdline != parent.cmdline) {
+			w.handleExec(&ProcEventExec{Pid: pid, Tid: pid})
+		}
+	}
+
+	for _, pid := range execed {
+		w.handleExec(&ProcEventExec{Pid: pid, Tid: pid})
+	}
+}
@@ -3,99 +3,320 @@
 package psnotify
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"syscall"
+	"time"
 )
 
 type ProcEventFork struct {
-	ParentPid int // Pid of the process that called fork()
-	ChildPid  int // Child process pid created by fork()
+	ParentPid int           // Pid of the process that called fork()
+	ParentTid int           // Tid of the thread that called fork()
+	ChildPid  int           // Child process pid created by fork()
+	ChildTid  int           // Tid of the main thread of the child
+	Timestamp time.Duration // Time of the event on the monotonic clock
+	Cpu       int           // CPU on which the event occurred
 }
 
 type ProcEventExec struct {
-	Pid int // Pid of the process that called exec()
+	Pid       int           // Pid of the process that called exec()
+	Tid       int           // Tid of the thread that called exec()
+	Timestamp time.Duration // Time of the event on the monotonic clock
+	Cpu       int           // CPU on which the event occurred
 }
 
+// The exit status is zero and StatusKnown is false when the process list
+// is polled, see Options. On darwin the exit status is only reported for
+// the children of the watching process.
+//
+// The Timestamp and Cpu fields of all the events are only set on Linux,
+// where Timestamp is the kernel's monotonic clock when the event occurred,
+// which does not advance during suspend, and Cpu is the CPU that reported
+// it. They are zero when the process list is polled. Pids are process ids
+// (thread group ids) and Tids are the ids of the threads, which are only
+// set on Linux and equal to the pid when the process list is polled.
 type ProcEventExit struct {
-	Pid int // Pid of the process that called exit()
+	Pid         int            // Pid of the process that called exit()
+	Tid         int            // Tid of the thread that exited, the pid for process exits
+	ExitCode    int            // Exit status of the process, only valid when Signal is 0
+	Signal      syscall.Signal // Signal that terminated the process, 0 if the process exited
+	CoreDumped  bool           // True if the process produced a core dump
+	StatusKnown bool           // True if the exit status above was reported, false if it is unknown
+	Timestamp   time.Duration  // Time of the event on the monotonic clock
+	Cpu         int            // CPU on which the event occurred
+}
+
+// The following events are only reported on Linux.
+
+type ProcEventClone struct {
+	Pid       int           // Pid of the process that created a thread
+	Tid       int           // Tid of the new thread
+	Timestamp time.Duration // Time of the event on the monotonic clock
+	Cpu       int           // CPU on which the event occurred
+}
+
+// Thread exits have the fields of process exits,
+// Tid is the thread that exited.
+type ProcEventThreadExit struct {
+	ProcEventExit
+}
+
+type ProcEventUid struct {
+	Pid       int           // Pid of the process that changed its user ids
+	Ruid      int           // New real user id
+	Euid      int           // New effective user id
+	Timestamp time.Duration // Time of the event on the monotonic clock
+	Cpu       int           // CPU on which the event occurred
+}
+
+type ProcEventGid struct {
+	Pid       int           // Pid of the process that changed its group ids
+	Rgid      int           // New real group id
+	Egid      int           // New effective group id
+	Timestamp time.Duration // Time of the event on the monotonic clock
+	Cpu       int           // CPU on which the event occurred
+}
+
+type ProcEventSid struct {
+	Pid       int           // Pid of the process that called setsid()
+	Timestamp time.Duration // Time of the event on the monotonic clock
+	Cpu       int           // CPU on which the event occurred
+}
+
+type ProcEventPtrace struct {
+	Pid       int           // Pid of the traced process
+	TracerPid int           // Pid of the tracer that attached, 0 if the tracer detached
+	Timestamp time.Duration // Time of the event on the monotonic clock
+	Cpu       int           // CPU on which the event occurred
+}
+
+type ProcEventComm struct {
+	Pid       int           // Pid of the process that changed its command name
+	Comm      string        // New command name
+	Timestamp time.Duration // Time of the event on the monotonic clock
+	Cpu       int           // CPU on which the event occurred
+}
+
+type ProcEventCoredump struct {
+	Pid       int           // Pid of the process that dumped core
+	ParentPid int           // Pid of the parent of the process
+	Timestamp time.Duration // Time of the event on the monotonic clock
+	Cpu       int           // CPU on which the event occurred
+}
+
+// Sent on Linux when events were lost, because the netlink socket
+// overflowed or messages are missing from the kernel's sequence. The watched
+// process set is rebuilt from /proc before the event is sent.
+type ProcEventResync struct {
+	Added   []int // Pids of descendants of watched processes whose fork was lost
+	Removed []int // Pids of watched processes whose exit was lost
+}
+
+// Decodes a wait(2) style status into the exit code, terminating
+// signal and core dump flag of the exit event.
+func (ev *ProcEventExit) setStatus(status uint32) {
+	ev.StatusKnown = true
+	ws := syscall.WaitStatus(status)
+	if ws.Signaled() {
+		ev.Signal = ws.Signal()
+		ev.CoreDumped = ws.CoreDump()
+	} else {
+		ev.ExitCode = ws.ExitStatus()
+	}
 }
 
 type watch struct {
 	flags uint32 // Saved value of Watch() flags param
 }
 
+type watchAll struct {
+	flags  uint32     // Saved value of WatchAll() flags param
+	filter ProcFilter // Saved value of WatchAll() filter param
+}
+
+// ProcFilter reports whether the events of the process
+// with the given pid should be delivered by WatchAll().
+type ProcFilter func(pid int) bool
+
 type eventListener interface {
 	close() error // Watch.Close() closes the OS specific listener
 }
 
+// A Watcher is safe for concurrent use by multiple goroutines.
 type Watcher struct {
-	listener eventListener       // OS specifics (kqueue or netlink)
-	watches  map[int]*watch      // Map of watched process ids
-	Error    chan error          // Errors are sent on this channel
-	Fork     chan *ProcEventFork // Fork events are sent on this channel
-	Exec     chan *ProcEventExec // Exec events are sent on this channel
-	Exit     chan *ProcEventExit // Exit events are sent on this channel
-	done     chan bool           // Used to stop the readEvents() goroutine
-	isClosed bool                // Set to true when Close() is first called
+	listener   eventListener             // OS specifics (kqueue or netlink)
+	mu         sync.Mutex                // Protects watches, all, exits and isClosed
+	watches    map[int]*watch            // Map of watched process ids
+	all        *watchAll                 // Set by WatchAll() to watch every process
+	exits      *exitWatcher              // Set by WatchExit() on Linux
+	Error      chan error                // Errors are sent on this channel
+	Fork       chan *ProcEventFork       // Fork events are sent on this channel
+	Exec       chan *ProcEventExec       // Exec events are sent on this channel
+	Exit       chan *ProcEventExit       // Exit events are sent on this channel
+	Uid        chan *ProcEventUid        // User id change events are sent on this channel
+	Gid        chan *ProcEventGid        // Group id change events are sent on this channel
+	Sid        chan *ProcEventSid        // Session id change events are sent on this channel
+	Ptrace     chan *ProcEventPtrace     // Ptrace attach and detach events are sent on this channel
+	Comm       chan *ProcEventComm       // Command name change events are sent on this channel
+	Coredump   chan *ProcEventCoredump   // Core dump events are sent on this channel
+	Clone      chan *ProcEventClone      // Thread creation events are sent on this channel
+	ThreadExit chan *ProcEventThreadExit // Thread exit events are sent on this channel
+	Resync     chan *ProcEventResync     // Resync events are sent on this channel, without blocking
+	done       chan struct{}             // Closed by Close() to stop the readEvents() goroutine
+	finished   chan struct{}             // Closed when the readEvents() goroutine returns
+	isClosed   bool                      // Set to true when Close() is first called
+	closeOnce  sync.Once                 // Ensures the done channel is closed once
 }
 
 // Initialize event listener and channels
 func NewWatcher() (*Watcher, error) {
-	listener, err := createListener()
+	return NewWatcherContext(context.Background())
+}
+
+// Default interval of the process list polling, see Options.
+const DefaultPollInterval = time.Second
+
+// Options for NewWatcherOptions.
+type Options struct {
+	// Interval at which the process list is polled on Linux when binding
+	// the netlink connector fails with EPERM, e.g. in unprivileged
+	// containers. Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+
+	// Always poll the process list on Linux, even when the
+	// netlink connector is available.
+	Poll bool
+}
+
+// Initialize event listener and channels. The watcher
+// is closed when ctx is cancelled, as if Close() was called.
+func NewWatcherContext(ctx context.Context) (*Watcher, error) {
+	return NewWatcherOptions(ctx, Options{})
+}
+
+// Initialize event listener and channels with the given options.
+// The watcher is closed when ctx is cancelled.
+func NewWatcherOptions(ctx context.Context, opts Options) (*Watcher, error) {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+
+	listener, err := createListener(opts)
 
 	if err != nil {
 		return nil, err
 	}
 
+	return newWatcher(ctx, listener), nil
+}
+
+// Initialize channels and start reading the events of listener.
+func newWatcher(ctx context.Context, listener eventListener) *Watcher {
 	w := &Watcher{
-		listener: listener,
-		watches:  make(map[int]*watch),
-		Fork:     make(chan *ProcEventFork),
-		Exec:     make(chan *ProcEventExec),
-		Exit:     make(chan *ProcEventExit),
-		Error:    make(chan error),
-		done:     make(chan bool, 1),
+		listener:   listener,
+		watches:    make(map[int]*watch),
+		Fork:       make(chan *ProcEventFork),
+		Exec:       make(chan *ProcEventExec),
+		Exit:       make(chan *ProcEventExit),
+		Uid:        make(chan *ProcEventUid),
+		Gid:        make(chan *ProcEventGid),
+		Sid:        make(chan *ProcEventSid),
+		Ptrace:     make(chan *ProcEventPtrace),
+		Comm:       make(chan *ProcEventComm),
+		Coredump:   make(chan *ProcEventCoredump),
+		Clone:      make(chan *ProcEventClone),
+		ThreadExit: make(chan *ProcEventThreadExit),
+		Resync:     make(chan *ProcEventResync, 1),
+		Error:      make(chan error),
+		done:       make(chan struct{}),
+		finished:   make(chan struct{}),
 	}
 
 	go w.readEvents()
-	return w, nil
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				w.Close()
+			case <-w.done:
+			}
+		}()
+	}
+
+	return w
 }
 
-// Close event channels when done message is received
+// Close event channels when the readEvents() goroutine returns
 func (w *Watcher) finish() {
+	w.stopExits()
+
 	close(w.Fork)
 	close(w.Exec)
 	close(w.Exit)
+	close(w.Uid)
+	close(w.Gid)
+	close(w.Sid)
+	close(w.Ptrace)
+	close(w.Comm)
+	close(w.Coredump)
+	close(w.Clone)
+	close(w.ThreadExit)
+	close(w.Resync)
 	close(w.Error)
+	close(w.finished)
 }
 
 // Closes the OS specific event listener,
 // removes all watches and closes all event channels.
+// The event channels are closed when Close() returns.
 func (w *Watcher) Close() error {
+	w.mu.Lock()
 	if w.isClosed {
+		w.mu.Unlock()
+		<-w.finished
 		return nil
 	}
 	w.isClosed = true
 
 	for pid := range w.watches {
-		w.RemoveWatch(pid)
+		w.removeWatch(pid)
 	}
+	w.all = nil
+	w.mu.Unlock()
 
-	w.done <- true
+	w.closeOnce.Do(func() { close(w.done) })
 
-	w.listener.close()
+	err := w.listener.close()
 
-	return nil
+	<-w.finished
+
+	return err
 }
 
 // Add pid to the watched process set.
 // The flags param is a bitmask of process events to capture,
-// must be one or more of: PROC_EVENT_FORK, PROC_EVENT_EXEC, PROC_EVENT_EXIT
+// must be one or more of: PROC_EVENT_FORK, PROC_EVENT_EXEC, PROC_EVENT_EXIT.
+// On Linux it may also contain: PROC_EVENT_UID, PROC_EVENT_GID,
+// PROC_EVENT_SID, PROC_EVENT_PTRACE, PROC_EVENT_COMM, PROC_EVENT_COREDUMP,
+// PROC_EVENT_THREADS.
+// Events are sent on the channel of each requested event type,
+// which must be read by the caller.
 func (w *Watcher) Watch(pid int, flags uint32) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	if w.isClosed {
 		return errors.New("psnotify watcher is closed")
 	}
 
+	return w.addWatch(pid, flags)
+}
+
+// Internal helper for Watch(), must be called with w.mu held.
+func (w *Watcher) addWatch(pid int, flags uint32) error {
 	watchEntry, found := w.watches[pid]
 
 	if found {
@@ -110,8 +331,71 @@ func (w *Watcher) Watch(pid int, flags uint32) error {
 	return nil
 }
 
+// Watch for the exit of pid, which must exist. Exactly one exit event is
+// sent for it on the Exit channel. On Linux 5.3 and later the process is
+// referred to by a pidfd, so a new process reusing the pid can't be
+// mistaken for it, non-child processes are supported and no privileges
+// are needed. The exit status is only known, see ProcEventExit.StatusKnown,
+// for children of the calling process that are not reaped yet when the
+// event is read. A WatchAll() watch for exit events may report it a second
+// time. Elsewhere this is the same as Watch(pid, PROC_EVENT_EXIT).
+func (w *Watcher) WatchExit(pid int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.isClosed {
+		return errors.New("psnotify watcher is closed")
+	}
+
+	return w.registerExit(pid)
+}
+
+// Watch all processes, including the ones that are not known yet.
+// The flags param has the same meaning as for Watch(). When filter
+// is not nil, only the events of processes for which it returns true
+// are delivered. The filter is called from the event reading goroutine
+// for every event, so it should be fast. Processes added with Watch()
+// are still reported with their own flags. Forks are not followed as
+// every process is watched already. Only supported on Linux.
+func (w *Watcher) WatchAll(flags uint32, filter ProcFilter) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.isClosed {
+		return errors.New("psnotify watcher is closed")
+	}
+
+	if err := w.registerAll(flags); err != nil {
+		return err
+	}
+	w.all = &watchAll{flags: flags, filter: filter}
+
+	return nil
+}
+
+// Stop watching all processes, as started by WatchAll().
+// Processes added with Watch() are still watched.
+func (w *Watcher) RemoveWatchAll() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.all == nil {
+		return errors.New("watch for all processes does not exist")
+	}
+	w.all = nil
+	return nil
+}
+
 // Remove pid from the watched process set.
 func (w *Watcher) RemoveWatch(pid int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.removeWatch(pid)
+}
+
+// Internal helper for RemoveWatch(), must be called with w.mu held.
+func (w *Watcher) removeWatch(pid int) error {
 	_, ok := w.watches[pid]
 	if !ok {
 		msg := fmt.Sprintf("watch for pid=%d does not exist", pid)
@@ -121,16 +405,51 @@ func (w *Watcher) RemoveWatch(pid int) error {
 	return w.unregister(pid)
 }
 
-// Internal helper to check if there is a message on the "done" channel.
-// The "done" message is sent by the Close() method; when received here,
-// the Watcher.finish method is called to close all channels and return
-// true - in which case the caller should break from the readEvents loop.
+// Internal helper to check if the watched flags of pid include event.
+// The WatchAll() filter is called without holding w.mu.
+func (w *Watcher) isWatching(pid int, event uint32) bool {
+	w.mu.Lock()
+	watch, ok := w.watches[pid]
+	if ok && (watch.flags&event) == event {
+		w.mu.Unlock()
+		return true
+	}
+	all := w.all
+	w.mu.Unlock()
+
+	if all != nil && (all.flags&event) == event {
+		return all.filter == nil || all.filter(pid)
+	}
+	return false
+}
+
+// Internal helper that returns the flags of the explicit watch for pid.
+func (w *Watcher) watchFlags(pid int) (uint32, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	watch, ok := w.watches[pid]
+	if !ok {
+		return 0, false
+	}
+	return watch.flags, true
+}
+
+// Internal helper to check if Close() was called, in which
+// case the caller should break from the readEvents loop.
 func (w *Watcher) isDone() bool {
-	var done bool
 	select {
-	case done = <-w.done:
-		w.finish()
+	case <-w.done:
+		return true
 	default:
+		return false
+	}
+}
+
+// Send an error unless the watcher is closed first.
+func (w *Watcher) sendError(err error) {
+	select {
+	case w.Error <- err:
+	case <-w.done:
 	}
-	return done
 }
@@ -6,7 +6,9 @@
 package psnotify
 
 import (
+	"errors"
 	"syscall"
+	"time"
 )
 
 const (
@@ -19,13 +21,18 @@ const (
 	PROC_EVENT_ALL = PROC_EVENT_FORK | PROC_EVENT_EXEC | PROC_EVENT_EXIT
 )
 
+// Maximum time readEvents() waits for events before checking
+// whether the watcher was closed.
+const pollTimeout = 100 * time.Millisecond
+
 type kqueueListener struct {
 	kq  int                 // The syscall.Kqueue() file descriptor
 	buf [1]syscall.Kevent_t // An event buffer for Add/Remove watch
 }
 
-// Initialize bsd implementation of the eventListener interface
-func createListener() (eventListener, error) {
+// Initialize bsd implementation of the eventListener interface,
+// kqueue is always available so opts are ignored
+func createListener(opts Options) (eventListener, error) {
 	listener := &kqueueListener{}
 	kq, err := syscall.Kqueue()
 	listener.kq = kq
@@ -45,6 +52,17 @@ func (w *Watcher) kevent(pid int, fflags uint32, flags int) error {
 	return err
 }
 
+// kqueue exit events already refer to a single process
+type exitWatcher struct{}
+
+// Must be called with w.mu held.
+func (w *Watcher) registerExit(pid int) error {
+	return w.addWatch(pid, PROC_EVENT_EXIT)
+}
+
+// noop on bsd, exits are read by readEvents()
+func (w *Watcher) stopExits() {}
+
 // Delete filter for given pid from the queue
 func (w *Watcher) unregister(pid int) error {
 	return w.kevent(pid, 0, syscall.EV_DELETE)
@@ -52,36 +70,75 @@ func (w *Watcher) unregister(pid int) error {
 
 // Add and enable filter for given pid in the queue
 func (w *Watcher) register(pid int, flags uint32) error {
+	if flags&PROC_EVENT_EXIT != 0 && noteExitStatus != 0 {
+		// darwin only reports the exit status of children.
+		err := w.kevent(pid, flags|noteExitStatus, syscall.EV_ADD|syscall.EV_ENABLE)
+		if err != syscall.EACCES {
+			return err
+		}
+	}
 	return w.kevent(pid, flags, syscall.EV_ADD|syscall.EV_ENABLE)
 }
 
-// Poll the kqueue file descriptor and dispatch to the Event channels
+// kqueue can only watch known pids
+func (w *Watcher) registerAll(flags uint32) error {
+	return errors.New("watching all processes is not supported by kqueue")
+}
+
+// Poll the kqueue file descriptor and dispatch to the Event channels.
+// Kevent() waits with a timeout, as closing the kqueue file descriptor
+// does not interrupt it, so that Close() is noticed promptly.
 func (w *Watcher) readEvents() {
+	defer w.finish()
+
 	listener, _ := w.listener.(*kqueueListener)
 	events := make([]syscall.Kevent_t, 10)
+	timeout := syscall.NsecToTimespec(int64(pollTimeout))
 
 	for {
 		if w.isDone() {
 			return
 		}
 
-		n, err := syscall.Kevent(listener.kq, nil, events, nil)
+		n, err := syscall.Kevent(listener.kq, nil, events, &timeout)
 		if err != nil {
-			w.Error <- err
+			if w.isDone() {
+				return
+			}
+			if err != syscall.EINTR {
+				w.sendError(err)
+			}
 			continue
 		}
 
 		for _, ev := range events[:n] {
 			pid := int(ev.Ident)
 
-			switch ev.Fflags {
-			case syscall.NOTE_FORK:
-				w.Fork <- &ProcEventFork{ParentPid: pid}
-			case syscall.NOTE_EXEC:
-				w.Exec <- &ProcEventExec{Pid: pid}
-			case syscall.NOTE_EXIT:
+			// Flags such as NOTE_EXITSTATUS are reported with the event.
+			switch {
+			case ev.Fflags&syscall.NOTE_FORK != 0:
+				select {
+				case w.Fork <- &ProcEventFork{ParentPid: pid}:
+				case <-w.done:
+				}
+			case ev.Fflags&syscall.NOTE_EXEC != 0:
+				select {
+				case w.Exec <- &ProcEventExec{Pid: pid}:
+				case <-w.done:
+				}
+			case ev.Fflags&syscall.NOTE_EXIT != 0:
 				w.RemoveWatch(pid)
-				w.Exit <- &ProcEventExit{Pid: pid}
+				// The data of a NOTE_EXIT event holds the
+				// wait(2) status, on darwin only with
+				// NOTE_EXITSTATUS.
+				exit := &ProcEventExit{Pid: pid}
+				if noteExitStatus == 0 || ev.Fflags&noteExitStatus != 0 {
+					exit.setStatus(uint32(ev.Data))
+				}
+				select {
+				case w.Exit <- exit:
+				case <-w.done:
+				}
 			}
 		}
 	}
@@ -0,0 +1,8 @@
+// Copyright (c) 2012 VMware, Inc.
+
+// +build freebsd netbsd openbsd
+
+package psnotify
+
+// The other BSDs always report the exit status with NOTE_EXIT.
+const noteExitStatus = 0
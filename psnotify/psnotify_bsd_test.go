@@ -0,0 +1,9 @@
+// +build darwin freebsd netbsd openbsd
+
+package psnotify
+
+import "testing"
+
+// Noop, kqueue only reports the events of processes
+// registered before the events occurred.
+func waitExitHandled(t *testing.T, pid int) {}
@@ -0,0 +1,9 @@
+// Copyright (c) 2012 VMware, Inc.
+
+package psnotify
+
+import "syscall"
+
+// Requests the exit status with NOTE_EXIT, which darwin only
+// grants to the parent of the process.
+const noteExitStatus = syscall.NOTE_EXITSTATUS
@@ -6,9 +6,15 @@ package psnotify
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"os"
+	"sort"
 	"syscall"
+	"time"
+
+	"github.com/elastic/gosigar"
 )
 
 const (
@@ -21,16 +27,32 @@ const (
 	_PROC_CN_MCAST_IGNORE = 2
 
 	// Flags (from <linux/cn_proc.h>)
-	PROC_EVENT_FORK = 0x00000001 // fork() events
-	PROC_EVENT_EXEC = 0x00000002 // exec() events
-	PROC_EVENT_EXIT = 0x80000000 // exit() events
-
-	// Watch for all process events
+	PROC_EVENT_FORK     = 0x00000001 // fork() events
+	PROC_EVENT_EXEC     = 0x00000002 // exec() events
+	PROC_EVENT_UID      = 0x00000004 // user id change events
+	PROC_EVENT_GID      = 0x00000040 // group id change events
+	PROC_EVENT_SID      = 0x00000080 // setsid() events
+	PROC_EVENT_PTRACE   = 0x00000100 // ptrace() attach and detach events
+	PROC_EVENT_COMM     = 0x00000200 // command name change events
+	PROC_EVENT_COREDUMP = 0x40000000 // core dump events
+	PROC_EVENT_EXIT     = 0x80000000 // exit() events
+
+	// Thread creation and exit events. Not a kernel event type, threads
+	// are reported by the kernel with the fork and exit events.
+	PROC_EVENT_THREADS = 0x00010000
+
+	// Watch for fork, exec and exit events.
+	// The other events must be requested explicitly,
+	// as their channels are not read by existing callers.
 	PROC_EVENT_ALL = PROC_EVENT_FORK | PROC_EVENT_EXEC | PROC_EVENT_EXIT
 )
 
 var (
 	byteOrder = binary.LittleEndian
+
+	// Receive buffer size of the netlink socket. The default
+	// size overflows with ENOBUFS when many processes fork at once.
+	recvBufferSize = 4 * 1024 * 1024
 )
 
 // linux/connector.h: struct cb_id
@@ -70,6 +92,8 @@ type execProcEvent struct {
 }
 
 // linux/cn_proc.h: struct proc_event.exit
+// ExitCode is the wait(2) status of the task and
+// ExitSignal the signal sent to its parent on exit.
 type exitProcEvent struct {
 	ProcessPid  uint32
 	ProcessTgid uint32
@@ -77,23 +101,112 @@ type exitProcEvent struct {
 	ExitSignal  uint32
 }
 
+// linux/cn_proc.h: struct proc_event.id
+// Id is the real uid/gid and EffectiveId the effective uid/gid.
+type idProcEvent struct {
+	ProcessPid  uint32
+	ProcessTgid uint32
+	Id          uint32
+	EffectiveId uint32
+}
+
+// linux/cn_proc.h: struct proc_event.sid
+type sidProcEvent struct {
+	ProcessPid  uint32
+	ProcessTgid uint32
+}
+
+// linux/cn_proc.h: struct proc_event.ptrace
+type ptraceProcEvent struct {
+	ProcessPid  uint32
+	ProcessTgid uint32
+	TracerPid   uint32
+	TracerTgid  uint32
+}
+
+// linux/cn_proc.h: struct proc_event.comm
+type commProcEvent struct {
+	ProcessPid  uint32
+	ProcessTgid uint32
+	Comm        [16]byte
+}
+
+// linux/cn_proc.h: struct proc_event.coredump
+type coredumpProcEvent struct {
+	ProcessPid  uint32
+	ProcessTgid uint32
+	ParentPid   uint32
+	ParentTgid  uint32
+}
+
 // standard netlink header + connector header
 type netlinkProcMessage struct {
 	Header syscall.NlMsghdr
 	Data   cnMsg
 }
 
-type netlinkListener struct {
+// NetlinkSource is read by a Watcher for the messages of the proc connector.
+// Each Read returns the data of one datagram, as received on the connector
+// socket. Close interrupts a pending Read. See OpenNetlinkSource,
+// NewRecorder and NewReplayer.
+type NetlinkSource interface {
+	Read(b []byte) (int, error)
+	Close() error
+}
+
+// The proc connector socket, implements NetlinkSource
+type netlinkSocket struct {
 	addr *syscall.SockaddrNetlink // Netlink socket address
 	sock int                      // The syscall.Socket() file descriptor
+	file *os.File                 // Non-blocking file wrapping sock, used for reading
 	seq  uint32                   // struct cn_msg.seq
 }
 
-// Initialize linux implementation of the eventListener interface
-func createListener() (eventListener, error) {
-	listener := &netlinkListener{}
-	err := listener.bind()
-	return listener, err
+type netlinkListener struct {
+	source NetlinkSource     // Messages of the connector
+	seqs   map[uint32]uint32 // Last struct cn_msg.seq received from each CPU
+}
+
+func newNetlinkListener(source NetlinkSource) *netlinkListener {
+	return &netlinkListener{source: source, seqs: make(map[uint32]uint32)}
+}
+
+// Initialize linux implementation of the eventListener interface.
+// The process list is polled when the netlink connector requires
+// privileges the process doesn't have.
+func createListener(opts Options) (eventListener, error) {
+	if opts.Poll {
+		return newPollListener(opts.PollInterval)
+	}
+
+	source, err := OpenNetlinkSource()
+	if err != nil {
+		if errors.Is(err, syscall.EPERM) {
+			return newPollListener(opts.PollInterval)
+		}
+		return nil, err
+	}
+	return newNetlinkListener(source), nil
+}
+
+// Open a socket listening to the proc connector, which requires
+// CAP_NET_ADMIN. Only one Watcher may read from the returned source.
+func OpenNetlinkSource() (NetlinkSource, error) {
+	socket := &netlinkSocket{sock: -1}
+	if err := socket.bind(); err != nil {
+		if socket.sock >= 0 {
+			syscall.Close(socket.sock)
+		}
+		return nil, err
+	}
+	return socket, nil
+}
+
+// Initialize event channels with a Watcher reading the proc connector
+// messages from source, which is closed by Close(). The watcher is closed
+// when ctx is cancelled.
+func NewWatcherSource(ctx context.Context, source NetlinkSource) (*Watcher, error) {
+	return newWatcher(ctx, newNetlinkListener(source)), nil
 }
 
 // noop on linux
@@ -106,8 +219,21 @@ func (w *Watcher) register(pid int, flags uint32) error {
 	return nil
 }
 
-// Read events from the netlink socket
+// noop on linux, netlink delivers the events of all processes
+func (w *Watcher) registerAll(flags uint32) error {
+	return nil
+}
+
+// Read events from the netlink socket. Reads are interrupted
+// by Close(), which closes the file wrapping the socket.
 func (w *Watcher) readEvents() {
+	defer w.finish()
+
+	if listener, ok := w.listener.(*pollListener); ok {
+		w.pollEvents(listener)
+		return
+	}
+
 	buf := make([]byte, syscall.Getpagesize())
 
 	listener, _ := w.listener.(*netlinkListener)
@@ -117,39 +243,48 @@ func (w *Watcher) readEvents() {
 			return
 		}
 
-		nr, _, err := syscall.Recvfrom(listener.sock, buf, 0)
+		nr, err := listener.source.Read(buf)
 
 		if err != nil {
-			w.Error <- err
+			if w.isDone() {
+				return
+			}
+			if errors.Is(err, syscall.ENOBUFS) {
+				// the socket overflowed and events were dropped,
+				// the sequence numbers restart from the next events
+				listener.seqs = make(map[uint32]uint32)
+				w.resync()
+				continue
+			}
+			w.sendError(err)
 			continue
 		}
 		if nr < syscall.NLMSG_HDRLEN {
-			w.Error <- syscall.EINVAL
+			w.sendError(syscall.EINVAL)
 			continue
 		}
 
 		msgs, _ := syscall.ParseNetlinkMessage(buf[:nr])
 
+		lost := false
 		for _, m := range msgs {
 			if m.Header.Type == syscall.NLMSG_DONE {
-				w.handleEvent(m.Data)
+				if w.handleEvent(m.Data) {
+					lost = true
+				}
 			}
 		}
+		if lost {
+			w.resync()
+		}
 	}
 }
 
-// Internal helper to check if pid && event is being watched
-func (w *Watcher) isWatching(pid int, event uint32) bool {
-	if watch, ok := w.watches[pid]; ok {
-		return (watch.flags & event) == event
-	}
-	return false
-}
-
 // Dispatch events from the netlink socket to the Event channels.
 // Unlike bsd kqueue, netlink receives events for all pids,
-// so we apply filtering based on the watch table via isWatching()
-func (w *Watcher) handleEvent(data []byte) {
+// so we apply filtering based on the watch table via isWatching().
+// Returns true if messages were lost before this one.
+func (w *Watcher) handleEvent(data []byte) bool {
 	buf := bytes.NewBuffer(data)
 	msg := &cnMsg{}
 	hdr := &procEventHeader{}
@@ -157,45 +292,315 @@ func (w *Watcher) handleEvent(data []byte) {
 	binary.Read(buf, byteOrder, msg)
 	binary.Read(buf, byteOrder, hdr)
 
+	listener, _ := w.listener.(*netlinkListener)
+	lost := listener.lost(hdr.Cpu, msg.Seq)
+
 	switch hdr.What {
 	case PROC_EVENT_FORK:
 		event := &forkProcEvent{}
 		binary.Read(buf, byteOrder, event)
-		ppid := int(event.ParentTgid)
-		pid := int(event.ChildTgid)
 
-		if w.isWatching(ppid, PROC_EVENT_EXEC) {
-			// follow forks
-			watch, _ := w.watches[ppid]
-			w.Watch(pid, watch.flags)
+		if event.ChildPid != event.ChildTgid {
+			// the parent of a thread is the parent of its process
+			pid := int(event.ChildTgid)
+			if w.isWatching(pid, PROC_EVENT_THREADS) {
+				ev := &ProcEventClone{
+					Pid:       pid,
+					Tid:       int(event.ChildPid),
+					Timestamp: time.Duration(hdr.Timestamp),
+					Cpu:       int(hdr.Cpu),
+				}
+				select {
+				case w.Clone <- ev:
+				case <-w.done:
+				}
+			}
+			break
 		}
 
-		if w.isWatching(ppid, PROC_EVENT_FORK) {
-			w.Fork <- &ProcEventFork{ParentPid: ppid, ChildPid: pid}
-		}
+		w.handleFork(&ProcEventFork{
+			ParentPid: int(event.ParentTgid),
+			ParentTid: int(event.ParentPid),
+			ChildPid:  int(event.ChildTgid),
+			ChildTid:  int(event.ChildPid),
+			Timestamp: time.Duration(hdr.Timestamp),
+			Cpu:       int(hdr.Cpu),
+		})
 	case PROC_EVENT_EXEC:
 		event := &execProcEvent{}
 		binary.Read(buf, byteOrder, event)
+		w.handleExec(&ProcEventExec{
+			Pid:       int(event.ProcessTgid),
+			Tid:       int(event.ProcessPid),
+			Timestamp: time.Duration(hdr.Timestamp),
+			Cpu:       int(hdr.Cpu),
+		})
+	case PROC_EVENT_EXIT:
+		event := &exitProcEvent{}
+		binary.Read(buf, byteOrder, event)
+		ev := &ProcEventExit{
+			Pid:       int(event.ProcessTgid),
+			Tid:       int(event.ProcessPid),
+			Timestamp: time.Duration(hdr.Timestamp),
+			Cpu:       int(hdr.Cpu),
+		}
+		ev.setStatus(event.ExitCode)
+
+		if event.ProcessPid != event.ProcessTgid {
+			// the process is still running, its watch is kept
+			if w.isWatching(ev.Pid, PROC_EVENT_THREADS) {
+				tev := &ProcEventThreadExit{*ev}
+				select {
+				case w.ThreadExit <- tev:
+				case <-w.done:
+				}
+			}
+			break
+		}
+
+		w.handleExit(ev)
+	case PROC_EVENT_UID:
+		event := &idProcEvent{}
+		binary.Read(buf, byteOrder, event)
 		pid := int(event.ProcessTgid)
 
-		if w.isWatching(pid, PROC_EVENT_EXEC) {
-			w.Exec <- &ProcEventExec{Pid: pid}
+		if w.isWatching(pid, PROC_EVENT_UID) {
+			ev := &ProcEventUid{
+				Pid:       pid,
+				Ruid:      int(event.Id),
+				Euid:      int(event.EffectiveId),
+				Timestamp: time.Duration(hdr.Timestamp),
+				Cpu:       int(hdr.Cpu),
+			}
+			select {
+			case w.Uid <- ev:
+			case <-w.done:
+			}
 		}
-	case PROC_EVENT_EXIT:
-		event := &exitProcEvent{}
+	case PROC_EVENT_GID:
+		event := &idProcEvent{}
 		binary.Read(buf, byteOrder, event)
 		pid := int(event.ProcessTgid)
 
-		if w.isWatching(pid, PROC_EVENT_EXIT) {
-			w.RemoveWatch(pid)
-			w.Exit <- &ProcEventExit{Pid: pid}
+		if w.isWatching(pid, PROC_EVENT_GID) {
+			ev := &ProcEventGid{
+				Pid:       pid,
+				Rgid:      int(event.Id),
+				Egid:      int(event.EffectiveId),
+				Timestamp: time.Duration(hdr.Timestamp),
+				Cpu:       int(hdr.Cpu),
+			}
+			select {
+			case w.Gid <- ev:
+			case <-w.done:
+			}
+		}
+	case PROC_EVENT_SID:
+		event := &sidProcEvent{}
+		binary.Read(buf, byteOrder, event)
+		pid := int(event.ProcessTgid)
+
+		if w.isWatching(pid, PROC_EVENT_SID) {
+			ev := &ProcEventSid{
+				Pid:       pid,
+				Timestamp: time.Duration(hdr.Timestamp),
+				Cpu:       int(hdr.Cpu),
+			}
+			select {
+			case w.Sid <- ev:
+			case <-w.done:
+			}
+		}
+	case PROC_EVENT_PTRACE:
+		event := &ptraceProcEvent{}
+		binary.Read(buf, byteOrder, event)
+		pid := int(event.ProcessTgid)
+
+		if w.isWatching(pid, PROC_EVENT_PTRACE) {
+			ev := &ProcEventPtrace{
+				Pid:       pid,
+				TracerPid: int(event.TracerTgid),
+				Timestamp: time.Duration(hdr.Timestamp),
+				Cpu:       int(hdr.Cpu),
+			}
+			select {
+			case w.Ptrace <- ev:
+			case <-w.done:
+			}
+		}
+	case PROC_EVENT_COMM:
+		event := &commProcEvent{}
+		binary.Read(buf, byteOrder, event)
+		pid := int(event.ProcessTgid)
+
+		if w.isWatching(pid, PROC_EVENT_COMM) {
+			ev := &ProcEventComm{
+				Pid:       pid,
+				Comm:      string(bytes.TrimRight(event.Comm[:], "\x00")),
+				Timestamp: time.Duration(hdr.Timestamp),
+				Cpu:       int(hdr.Cpu),
+			}
+			select {
+			case w.Comm <- ev:
+			case <-w.done:
+			}
+		}
+	case PROC_EVENT_COREDUMP:
+		event := &coredumpProcEvent{}
+		binary.Read(buf, byteOrder, event)
+		pid := int(event.ProcessTgid)
+
+		if w.isWatching(pid, PROC_EVENT_COREDUMP) {
+			ev := &ProcEventCoredump{
+				Pid:       pid,
+				ParentPid: int(event.ParentTgid),
+				Timestamp: time.Duration(hdr.Timestamp),
+				Cpu:       int(hdr.Cpu),
+			}
+			select {
+			case w.Coredump <- ev:
+			case <-w.done:
+			}
 		}
 	}
+
+	return lost
+}
+
+// Sends a fork event if the parent is watched and follows
+// the fork if the parent watches exec events.
+func (w *Watcher) handleFork(ev *ProcEventFork) {
+	if flags, ok := w.watchFlags(ev.ParentPid); ok && (flags&PROC_EVENT_EXEC) != 0 {
+		// follow forks
+		w.Watch(ev.ChildPid, flags)
+	}
+
+	if w.isWatching(ev.ParentPid, PROC_EVENT_FORK) {
+		select {
+		case w.Fork <- ev:
+		case <-w.done:
+		}
+	}
+}
+
+// Sends an exec event if the process is watched.
+func (w *Watcher) handleExec(ev *ProcEventExec) {
+	if w.isWatching(ev.Pid, PROC_EVENT_EXEC) {
+		select {
+		case w.Exec <- ev:
+		case <-w.done:
+		}
+	}
+}
+
+// Called once the exit of a process was handled, whether the process
+// is watched or not. The tests set it to wait for the events that
+// preceded the exit to be handled.
+var exitHandled = func(pid int) {}
+
+// Sends an exit event if the process is watched and removes its watch.
+// The event of processes added with WatchExit() is sent by readExits().
+func (w *Watcher) handleExit(ev *ProcEventExit) {
+	defer exitHandled(ev.Pid)
+
+	if w.isWatchingExit(ev.Pid) {
+		w.RemoveWatch(ev.Pid)
+		return
+	}
+
+	if w.isWatching(ev.Pid, PROC_EVENT_EXIT) {
+		// the watch may only exist through WatchAll()
+		w.RemoveWatch(ev.Pid)
+		select {
+		case w.Exit <- ev:
+		case <-w.done:
+		}
+	}
+}
+
+// Sequence numbers are counted per CPU by the kernel for every event.
+// Returns true if the seq received from cpu does not follow the last one.
+func (listener *netlinkListener) lost(cpu uint32, seq uint32) bool {
+	last, ok := listener.seqs[cpu]
+	listener.seqs[cpu] = seq
+	return ok && seq != last+1
+}
+
+// Rebuilds the watched process set after events were lost. Watches of
+// processes that no longer exist are removed and the descendants of
+// processes whose forks are followed are added, based on the parent
+// pids in /proc/[pid]/stat. A ProcEventResync is then sent.
+func (w *Watcher) resync() {
+	list := gosigar.ProcList{}
+	if err := list.Get(); err != nil {
+		w.sendError(err)
+		return
+	}
+
+	alive := make(map[int]bool, len(list.List))
+	children := make(map[int][]int)
+	for _, pid := range list.List {
+		state := gosigar.ProcState{}
+		if err := state.Get(pid); err != nil {
+			// exited since the list was read
+			continue
+		}
+		alive[pid] = true
+		children[state.Ppid] = append(children[state.Ppid], pid)
+	}
+
+	ev := &ProcEventResync{}
+
+	w.mu.Lock()
+	if w.isClosed {
+		w.mu.Unlock()
+		return
+	}
+
+	// processes whose exit events were lost
+	for pid := range w.watches {
+		if !alive[pid] {
+			w.removeWatch(pid)
+			ev.Removed = append(ev.Removed, pid)
+		}
+	}
+
+	// forks that were lost, see the fork following in handleEvent()
+	var queue []int
+	for pid, watch := range w.watches {
+		if (watch.flags & PROC_EVENT_EXEC) != 0 {
+			queue = append(queue, pid)
+		}
+	}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		flags := w.watches[pid].flags
+
+		for _, child := range children[pid] {
+			if _, found := w.watches[child]; found {
+				continue
+			}
+			w.watches[child] = &watch{flags: flags}
+			ev.Added = append(ev.Added, child)
+			queue = append(queue, child)
+		}
+	}
+	w.mu.Unlock()
+
+	sort.Ints(ev.Added)
+	sort.Ints(ev.Removed)
+
+	// never block, callers that don't read Resync would deadlock
+	select {
+	case w.Resync <- ev:
+	default:
+	}
 }
 
 // Bind our netlink socket and
 // send a listen control message to the connector driver.
-func (listener *netlinkListener) bind() error {
+func (socket *netlinkSocket) bind() error {
 	sock, err := syscall.Socket(
 		syscall.AF_NETLINK,
 		syscall.SOCK_DGRAM,
@@ -205,39 +610,67 @@ func (listener *netlinkListener) bind() error {
 		return err
 	}
 
-	listener.sock = sock
-	listener.addr = &syscall.SockaddrNetlink{
+	socket.sock = sock
+	socket.addr = &syscall.SockaddrNetlink{
 		Family: syscall.AF_NETLINK,
 		Groups: _CN_IDX_PROC,
 	}
 
-	err = syscall.Bind(listener.sock, listener.addr)
+	// SO_RCVBUFFORCE ignores the rmem_max limit but requires
+	// CAP_NET_ADMIN, which is also needed to listen to the connector.
+	err = syscall.SetsockoptInt(socket.sock, syscall.SOL_SOCKET, syscall.SO_RCVBUFFORCE, recvBufferSize)
+	if err != nil {
+		syscall.SetsockoptInt(socket.sock, syscall.SOL_SOCKET, syscall.SO_RCVBUF, recvBufferSize)
+	}
+
+	err = syscall.Bind(socket.sock, socket.addr)
 
 	if err != nil {
 		return err
 	}
 
-	return listener.send(_PROC_CN_MCAST_LISTEN)
+	if err = socket.send(_PROC_CN_MCAST_LISTEN); err != nil {
+		return err
+	}
+
+	// A non-blocking file is registered with the runtime poller,
+	// so closing it interrupts a pending Read().
+	if err = syscall.SetNonblock(socket.sock, true); err != nil {
+		return err
+	}
+	socket.file = os.NewFile(uintptr(socket.sock), "netlink")
+
+	return nil
+}
+
+// Read a message from the socket, interrupted by Close().
+func (socket *netlinkSocket) Read(b []byte) (int, error) {
+	return socket.file.Read(b)
 }
 
 // Send an ignore control message to the connector driver
 // and close our netlink socket.
-func (listener *netlinkListener) close() error {
-	err := listener.send(_PROC_CN_MCAST_IGNORE)
-	syscall.Close(listener.sock)
+func (socket *netlinkSocket) Close() error {
+	err := socket.send(_PROC_CN_MCAST_IGNORE)
+	socket.file.Close()
 	return err
 }
 
+// Close the source of the connector messages.
+func (listener *netlinkListener) close() error {
+	return listener.source.Close()
+}
+
 // Generic method for sending control messages to the connector
 // driver; where op is one of PROC_CN_MCAST_{LISTEN,IGNORE}
-func (listener *netlinkListener) send(op uint32) error {
-	listener.seq++
+func (socket *netlinkSocket) send(op uint32) error {
+	socket.seq++
 	pr := &netlinkProcMessage{}
 	plen := binary.Size(pr.Data) + binary.Size(op)
 	pr.Header.Len = syscall.NLMSG_HDRLEN + uint32(plen)
 	pr.Header.Type = uint16(syscall.NLMSG_DONE)
 	pr.Header.Flags = 0
-	pr.Header.Seq = listener.seq
+	pr.Header.Seq = socket.seq
 	pr.Header.Pid = uint32(os.Getpid())
 
 	pr.Data.Id.Idx = _CN_IDX_PROC
@@ -249,5 +682,5 @@ func (listener *netlinkListener) send(op uint32) error {
 	binary.Write(buf, byteOrder, pr)
 	binary.Write(buf, byteOrder, op)
 
-	return syscall.Sendto(listener.sock, buf.Bytes(), 0, listener.addr)
+	return syscall.Sendto(socket.sock, buf.Bytes(), 0, socket.addr)
 }
@@ -0,0 +1,461 @@
+package psnotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/elastic/gosigar"
+)
+
+// Channels closed once the exit of each pid was handled by a watcher
+var handledExits = struct {
+	sync.Mutex
+	pids map[int]chan struct{}
+}{pids: make(map[int]chan struct{})}
+
+func init() {
+	exitHandled = func(pid int) {
+		ch := handledExit(pid)
+		handledExits.Lock()
+		defer handledExits.Unlock()
+		select {
+		case <-ch:
+		default:
+			close(ch)
+		}
+	}
+}
+
+func handledExit(pid int) chan struct{} {
+	handledExits.Lock()
+	defer handledExits.Unlock()
+	ch, found := handledExits.pids[pid]
+	if !found {
+		ch = make(chan struct{})
+		handledExits.pids[pid] = ch
+	}
+	return ch
+}
+
+// Waits for the exit of pid to be handled. Netlink delivers the events
+// in order, so the events that preceded the exit were handled too.
+func waitExitHandled(t *testing.T, pid int) {
+	select {
+	case <-handledExit(pid):
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for the exit of pid=%d to be handled", pid)
+	}
+}
+
+func TestWatchComm(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	pid := os.Getpid()
+
+	// a process can only change the comm of its own threads
+	commFile := fmt.Sprintf("/proc/%d/comm", pid)
+	comm, err := ioutil.ReadFile(commFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ioutil.WriteFile(commFile, bytes.TrimSpace(comm), 0644)
+
+	tw := newTestWatcher(t)
+
+	comms := make(chan *ProcEventComm, 1)
+	go func() {
+		comms <- <-tw.watcher.Comm
+	}()
+
+	if err := tw.watcher.Watch(pid, PROC_EVENT_COMM); err != nil {
+		t.Error(err)
+	}
+
+	// writing the comm file triggers a comm event
+	if err := ioutil.WriteFile(commFile, []byte("psnotify-test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-comms:
+		expectEventPid(t, "comm", pid, ev.Pid)
+		if ev.Comm != "psnotify-test" {
+			t.Errorf("Expected comm=psnotify-test, received=%s", ev.Comm)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected comm event")
+	}
+
+	tw.watcher.RemoveWatch(pid)
+	tw.close()
+}
+
+func TestWatchAll(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	pid := os.Getpid()
+
+	tw := newTestWatcher(t)
+
+	// watch the exec events of all children of this process,
+	// without knowing their pids in advance
+	if err := tw.watcher.WatchAll(PROC_EVENT_EXEC, ParentFilter(pid)); err != nil {
+		t.Error(err)
+	}
+
+	// the children keep running, so the filter can read their
+	// parent pid when the events are handled
+	children := map[int]bool{}
+	for i := 0; i < 2; i++ {
+		cmd := startSleepCommand(t)
+		defer cmd.Wait()
+		defer syscall.Kill(cmd.Process.Pid, syscall.SIGTERM)
+		children[cmd.Process.Pid] = false
+	}
+
+	tw.close()
+
+	expectEvents(t, 0, "forks", tw.events.forks)
+	expectEvents(t, 0, "exits", tw.events.exits)
+
+	// the shell may exec sleep, so there can be more than one exec per child
+	for _, epid := range tw.events.execs {
+		if _, ok := children[epid]; !ok {
+			t.Errorf("Unexpected exec pid=%d", epid)
+		}
+		children[epid] = true
+	}
+	for childPid, found := range children {
+		if !found {
+			t.Errorf("Expected exec event for pid=%d", childPid)
+		}
+	}
+
+	// forks were not followed
+	tw.watcher.mu.Lock()
+	watches := len(tw.watcher.watches)
+	tw.watcher.mu.Unlock()
+	if watches != 0 {
+		t.Errorf("Expected no watches, got=%d", watches)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	pid := os.Getpid()
+
+	comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter ProcFilter
+		match  bool
+	}{
+		{"parent", ParentFilter(os.Getppid()), true},
+		{"other parent", ParentFilter(pid), false},
+		{"uid", UidFilter(os.Getuid()), true},
+		{"other uid", UidFilter(os.Getuid() + 1), false},
+		{"comm", CommFilter(strings.TrimSpace(string(comm))), true},
+		{"other comm", CommFilter("psnotify-none"), false},
+		{"cgroup", CgroupFilter("/"), true},
+		{"other cgroup", CgroupFilter("/psnotify-none"), false},
+	}
+
+	for _, test := range tests {
+		if match := test.filter(pid); match != test.match {
+			t.Errorf("Expected %s filter match=%v, received=%v", test.name, test.match, match)
+		}
+	}
+
+	// processes that do not exist never match
+	if ParentFilter(os.Getppid())(-1) {
+		t.Error("Expected no match for a missing process")
+	}
+
+	// the files are read from gosigar.Procd
+	procd, err := ioutil.TempDir("", "psnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(procd)
+
+	files := map[string]string{
+		"comm":   "worker\n",
+		"status": "Name:\tworker\nPPid:\t1\nUid:\t1000\t1000\t1000\t1000\n",
+		"cgroup": "0::/system.slice/worker.service\n",
+	}
+	if err := os.Mkdir(filepath.Join(procd, "1234"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(procd, "1234", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(procd string) { gosigar.Procd = procd }(gosigar.Procd)
+	gosigar.Procd = procd
+
+	for name, filter := range map[string]ProcFilter{
+		"parent": ParentFilter(1),
+		"uid":    UidFilter(1000),
+		"comm":   CommFilter("worker"),
+		"cgroup": CgroupFilter("/system.slice"),
+	} {
+		if !filter(1234) {
+			t.Errorf("Expected %s filter to match the process of %s", name, procd)
+		}
+	}
+}
+
+// Watcher without a netlink socket, events are passed to handleEvent()
+func newResyncWatcher() *Watcher {
+	return &Watcher{
+		listener: &netlinkListener{seqs: make(map[uint32]uint32)},
+		watches:  make(map[int]*watch),
+		Exit:     make(chan *ProcEventExit, 10),
+		Resync:   make(chan *ProcEventResync, 1),
+		Error:    make(chan error, 10),
+		done:     make(chan struct{}),
+	}
+}
+
+// Builds the netlink payload of an event
+func eventData(cpu uint32, seq uint32, what uint32, event interface{}) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, byteOrder, &cnMsg{Seq: seq})
+	binary.Write(buf, byteOrder, &procEventHeader{What: what, Cpu: cpu})
+	binary.Write(buf, byteOrder, event)
+	return buf.Bytes()
+}
+
+func exitEventData(cpu uint32, seq uint32, pid int) []byte {
+	event := &exitProcEvent{ProcessPid: uint32(pid), ProcessTgid: uint32(pid)}
+	return eventData(cpu, seq, PROC_EVENT_EXIT, event)
+}
+
+func TestHandleEventLost(t *testing.T) {
+	w := newResyncWatcher()
+
+	// pids that are not watched, only the sequence matters
+	pid := 1 << 22
+	tests := []struct {
+		cpu  uint32
+		seq  uint32
+		lost bool
+	}{
+		{0, 5, false},
+		{0, 6, false},
+		{1, 100, false},
+		{0, 8, true},
+		{1, 101, false},
+		{0, 9, false},
+		{1, 99, true},
+	}
+
+	for i, test := range tests {
+		lost := w.handleEvent(exitEventData(test.cpu, test.seq, pid))
+		if lost != test.lost {
+			t.Errorf("Expected lost=%v for event %d, received=%v", test.lost, i, lost)
+		}
+	}
+}
+
+func TestResync(t *testing.T) {
+	w := newResyncWatcher()
+
+	// the exit of this process is never seen by the watcher
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+	exitedPid := exited.Process.Pid
+
+	pid := os.Getpid()
+	w.Watch(pid, PROC_EVENT_FORK|PROC_EVENT_EXEC|PROC_EVENT_EXIT)
+	w.Watch(exitedPid, PROC_EVENT_EXIT)
+
+	// the fork of this process is never seen by the watcher
+	cmd := startSleepCommand(t)
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	childPid := cmd.Process.Pid
+
+	w.resync()
+
+	var ev *ProcEventResync
+	select {
+	case ev = <-w.Resync:
+	case err := <-w.Error:
+		t.Fatal(err)
+	default:
+		t.Fatal("Expected resync event")
+	}
+
+	if len(ev.Removed) != 1 || ev.Removed[0] != exitedPid {
+		t.Errorf("Expected removed pid=%d, received=%v", exitedPid, ev.Removed)
+	}
+
+	found := false
+	for _, added := range ev.Added {
+		if added == childPid {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected added pid=%d, received=%v", childPid, ev.Added)
+	}
+
+	if flags, _ := w.watchFlags(childPid); flags != PROC_EVENT_FORK|PROC_EVENT_EXEC|PROC_EVENT_EXIT {
+		t.Errorf("Expected child to be watched with the parent flags, received=%x", flags)
+	}
+	if _, found := w.watchFlags(exitedPid); found {
+		t.Errorf("Expected pid=%d to be removed", exitedPid)
+	}
+}
+
+// Polling doesn't require privileges, so this test is also run as non-root.
+func TestPollWatcher(t *testing.T) {
+	w, err := NewWatcherOptions(context.Background(), Options{
+		Poll:         true,
+		PollInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if _, ok := w.listener.(*pollListener); !ok {
+		t.Fatalf("Expected poll listener, got=%T", w.listener)
+	}
+
+	pid := os.Getpid()
+	if err := w.Watch(pid, PROC_EVENT_ALL); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := startSleepCommand(t)
+	childPid := cmd.Process.Pid
+
+	timeout := time.After(5 * time.Second)
+	receive := func(name string) {
+		for {
+			select {
+			case ev := <-w.Fork:
+				if name == "fork" && ev.ChildPid == childPid {
+					expectEventPid(t, "fork", pid, ev.ParentPid)
+					return
+				}
+			case ev := <-w.Exec:
+				if name == "exec" && ev.Pid == childPid {
+					return
+				}
+			case ev := <-w.Exit:
+				if name == "exit" && ev.Pid == childPid {
+					return
+				}
+			case err := <-w.Error:
+				t.Fatal(err)
+			case <-timeout:
+				t.Fatalf("Timeout waiting for %s event of pid=%d", name, childPid)
+			}
+		}
+	}
+
+	// the child is found after it called exec(),
+	// so both events are sent by the same poll
+	receive("fork")
+	receive("exec")
+
+	syscall.Kill(childPid, syscall.SIGTERM)
+	cmd.Wait()
+
+	receive("exit")
+}
+
+// Uses the polling listener, so the test doesn't need privileges.
+func TestWatchExitPidfd(t *testing.T) {
+	pidfd, err := pidfdOpen(os.Getpid())
+	if err == syscall.ENOSYS {
+		fmt.Println("SKIP: test requires pidfd_open, available since linux 5.3")
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(pidfd)
+
+	w, err := NewWatcherOptions(context.Background(), Options{
+		Poll:         true,
+		PollInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// the child exits with status 3 once its stdin is closed
+	cmd := exec.Command("sh", "-c", "read line; exit 3")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	childPid := cmd.Process.Pid
+
+	// also watched by the polling listener, which must not send a second event
+	if err := w.Watch(childPid, PROC_EVENT_EXIT); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WatchExit(childPid); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin.Close()
+
+	// the child is reaped once its exit event is read, so the status is known
+	select {
+	case ev := <-w.Exit:
+		expectEventPid(t, "exit", childPid, ev.Pid)
+		if ev.ExitCode != 3 || !ev.StatusKnown {
+			t.Errorf("Expected exit code 3, received=%+v", ev)
+		}
+	case err := <-w.Error:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for exit event")
+	}
+
+	cmd.Wait()
+
+	select {
+	case ev := <-w.Exit:
+		t.Errorf("Expected a single exit event, received=%+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := w.WatchExit(childPid); err == nil {
+		t.Error("Expected error watching the exit of a reaped process")
+	}
+}
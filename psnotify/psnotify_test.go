@@ -3,21 +3,24 @@
 package psnotify
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
 )
 
 type anyEvent struct {
-	exits  []int
-	forks  []int
-	execs  []int
-	errors []error
-	done   chan bool
+	exits      []int
+	forks      []int
+	execs      []int
+	errors     []error
+	exitEvents []*ProcEventExit
+	done       chan bool
 }
 
 type testWatcher struct {
@@ -54,6 +57,7 @@ func newTestWatcher(t *testing.T) *testWatcher {
 				events.execs = append(events.execs, ev.Pid)
 			case ev := <-watcher.Exit:
 				events.exits = append(events.exits, ev.Pid)
+				events.exitEvents = append(events.exitEvents, ev)
 			case err := <-watcher.Error:
 				events.errors = append(events.errors, err)
 			}
@@ -124,7 +128,8 @@ func TestWatchFork(t *testing.T) {
 	tw := newTestWatcher(t)
 
 	// no watches added yet, so this fork event will no be captured
-	runCommand(t, "date")
+	cmd := runCommand(t, "date")
+	waitExitHandled(t, cmd.Process.Pid)
 
 	// watch fork events for this process
 	if err := tw.watcher.Watch(pid, PROC_EVENT_FORK); err != nil {
@@ -177,6 +182,64 @@ func TestWatchExit(t *testing.T) {
 	}
 }
 
+func TestWatchExitStatus(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	// Only linux reports the exit status for every exit event.
+	if runtime.GOOS != "linux" {
+		fmt.Println("SKIP: test exit status is linux only")
+		return
+	}
+
+	tw := newTestWatcher(t)
+
+	// the child exits with status 3 once its stdin is closed
+	exitCmd := exec.Command("sh", "-c", "read line; exit 3")
+	stdin, err := exitCmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exitCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	killCmd := startSleepCommand(t)
+
+	for _, cmd := range []*exec.Cmd{exitCmd, killCmd} {
+		if err := tw.watcher.Watch(cmd.Process.Pid, PROC_EVENT_EXIT); err != nil {
+			t.Error(err)
+		}
+	}
+
+	stdin.Close()
+	exitCmd.Wait()
+
+	syscall.Kill(killCmd.Process.Pid, syscall.SIGKILL)
+	killCmd.Wait()
+
+	tw.close()
+
+	if !expectEvents(t, 2, "exits", tw.events.exits) {
+		return
+	}
+
+	exit := tw.events.exitEvents[0]
+	expectEventPid(t, "exit", exitCmd.Process.Pid, exit.Pid)
+	if exit.ExitCode != 3 || exit.Signal != 0 || exit.CoreDumped || !exit.StatusKnown {
+		t.Errorf("Expected exit code 3, received=%+v", exit)
+	}
+	if exit.Timestamp == 0 {
+		t.Errorf("Expected exit timestamp, received=%+v", exit)
+	}
+
+	exit = tw.events.exitEvents[1]
+	expectEventPid(t, "exit", killCmd.Process.Pid, exit.Pid)
+	if exit.Signal != syscall.SIGKILL || exit.CoreDumped || !exit.StatusKnown {
+		t.Errorf("Expected SIGKILL, received=%+v", exit)
+	}
+}
+
 // combined version of TestWatchFork() and TestWatchExit()
 func TestWatchForkAndExit(t *testing.T) {
 	if skipTest(t) {
@@ -246,6 +309,8 @@ func TestWatchFollowFork(t *testing.T) {
 		childPids[i] = cmd.Process.Pid
 	}
 
+	waitExitHandled(t, childPids[len(childPids)-1])
+
 	// remove watch for this process
 	tw.watcher.RemoveWatch(pid)
 
@@ -281,3 +346,110 @@ func TestWatchFollowFork(t *testing.T) {
 		}
 	}
 }
+
+// Waits for the Exit channel, and so all event channels, to be closed.
+func expectClosed(t *testing.T, w *Watcher) {
+	select {
+	case _, ok := <-w.Exit:
+		if ok {
+			t.Error("Expected exit channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Timeout waiting for the event channels to be closed")
+	}
+}
+
+func TestWatcherClose(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	watcher, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nobody reads the event channels and no
+	// process is watched, so the reader is idle
+	closed := make(chan error, 1)
+	go func() {
+		closed <- watcher.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for Close() to return")
+	}
+
+	expectClosed(t, watcher)
+
+	if err := watcher.Watch(os.Getpid(), PROC_EVENT_ALL); err == nil {
+		t.Error("Expected error watching with a closed watcher")
+	}
+
+	// closing again is a noop
+	if err := watcher.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewWatcherContext(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watcher, err := NewWatcherContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := watcher.Watch(os.Getpid(), PROC_EVENT_ALL); err != nil {
+		t.Error(err)
+	}
+
+	cancel()
+
+	expectClosed(t, watcher)
+	watcher.Close()
+}
+
+// Run with -race to detect unsynchronized access to the watches.
+func TestWatcherConcurrentAccess(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	tw := newTestWatcher(t)
+
+	pid := os.Getpid()
+	if err := tw.watcher.Watch(pid, PROC_EVENT_FORK|PROC_EVENT_EXEC); err != nil {
+		t.Error(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				fake := 1<<22 + i*1000 + j
+				tw.watcher.Watch(fake, PROC_EVENT_ALL)
+				tw.watcher.RemoveWatch(fake)
+			}
+		}(i)
+	}
+
+	// forks are followed from the event reading goroutine
+	// while the watches are changed by the goroutines above
+	for i := 0; i < 5; i++ {
+		runCommand(t, "date")
+	}
+
+	wg.Wait()
+	tw.close()
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2012 VMware, Inc.
+
+package psnotify
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+)
+
+// Messages are recorded as a little-endian uint32 length followed by the
+// message data, as read from the proc connector socket.
+
+// Recorder is a NetlinkSource that writes the messages read from
+// another source to a writer, e.g. to attach a trace to a bug report.
+// The recording is played back by a Replayer.
+type Recorder struct {
+	source NetlinkSource
+	w      io.Writer
+}
+
+// Create a Recorder reading the messages of source and writing them to w.
+func NewRecorder(source NetlinkSource, w io.Writer) *Recorder {
+	return &Recorder{source: source, w: w}
+}
+
+// Read a message from the source and record it.
+func (r *Recorder) Read(b []byte) (int, error) {
+	nr, err := r.source.Read(b)
+	if err != nil {
+		return nr, err
+	}
+
+	var size [4]byte
+	byteOrder.PutUint32(size[:], uint32(nr))
+	if _, err := r.w.Write(size[:]); err != nil {
+		return 0, err
+	}
+	if _, err := r.w.Write(b[:nr]); err != nil {
+		return 0, err
+	}
+
+	return nr, nil
+}
+
+// Close the source, the writer is not closed.
+func (r *Recorder) Close() error {
+	return r.source.Close()
+}
+
+// Replayer is a NetlinkSource that plays back the messages recorded
+// by a Recorder. Read blocks until Start, so that the watches can be
+// added before the first message, and once all messages are read
+// until Close.
+type Replayer struct {
+	r         io.Reader
+	started   chan struct{} // Closed by Start()
+	done      chan struct{} // Closed when all messages were read
+	closed    chan struct{} // Closed by Close()
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+// Create a Replayer reading the messages recorded in r.
+func NewReplayer(r io.Reader) *Replayer {
+	return &Replayer{
+		r:       r,
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Start playing back the messages.
+func (r *Replayer) Start() {
+	r.startOnce.Do(func() {
+		close(r.started)
+	})
+}
+
+// Read the next recorded message.
+func (r *Replayer) Read(b []byte) (int, error) {
+	select {
+	case <-r.started:
+	case <-r.closed:
+		return 0, os.ErrClosed
+	}
+
+	select {
+	case <-r.done:
+		<-r.closed
+		return 0, os.ErrClosed
+	case <-r.closed:
+		return 0, os.ErrClosed
+	default:
+	}
+
+	var size uint32
+	if err := binary.Read(r.r, byteOrder, &size); err != nil {
+		close(r.done)
+		if err == io.EOF {
+			return r.Read(b)
+		}
+		return 0, err
+	}
+
+	if int(size) > len(b) {
+		close(r.done)
+		return 0, io.ErrShortBuffer
+	}
+	if _, err := io.ReadFull(r.r, b[:size]); err != nil {
+		close(r.done)
+		return 0, err
+	}
+
+	return int(size), nil
+}
+
+// Returns a channel that is closed when all recorded messages were read.
+// A Watcher has dispatched the events of a message before it reads the next.
+func (r *Replayer) Done() <-chan struct{} {
+	return r.done
+}
+
+// Interrupt a pending Read, the reader is not closed.
+func (r *Replayer) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+	return nil
+}
@@ -0,0 +1,212 @@
+package psnotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// NetlinkSource returning the given messages, then io.EOF
+type messageSource struct {
+	msgs [][]byte
+}
+
+func (s *messageSource) Read(b []byte) (int, error) {
+	if len(s.msgs) == 0 {
+		return 0, io.EOF
+	}
+	msg := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return copy(b, msg), nil
+}
+
+func (s *messageSource) Close() error {
+	return nil
+}
+
+// Wraps the payload of an event in a netlink message
+func netlinkMessage(data []byte) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, byteOrder, &syscall.NlMsghdr{
+		Len:  uint32(syscall.NLMSG_HDRLEN + len(data)),
+		Type: uint16(syscall.NLMSG_DONE),
+	})
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// Records the messages and returns the recording
+func record(t *testing.T, msgs ...[]byte) *bytes.Buffer {
+	recording := new(bytes.Buffer)
+	recorder := NewRecorder(&messageSource{msgs: msgs}, recording)
+
+	buf := make([]byte, syscall.Getpagesize())
+	for {
+		if _, err := recorder.Read(buf); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recording
+}
+
+func TestReplayFollowFork(t *testing.T) {
+	// pids that don't exist, the events are replayed
+	parent, child, other := 1<<22, 1<<22+1, 1<<22+2
+
+	recording := record(t,
+		netlinkMessage(eventData(0, 1, PROC_EVENT_FORK, &forkProcEvent{
+			ParentPid: uint32(parent), ParentTgid: uint32(parent),
+			ChildPid: uint32(child), ChildTgid: uint32(child),
+		})),
+		netlinkMessage(eventData(0, 2, PROC_EVENT_EXEC, &execProcEvent{
+			ProcessPid: uint32(child), ProcessTgid: uint32(child),
+		})),
+		netlinkMessage(exitEventData(1, 7, other)),
+		netlinkMessage(eventData(0, 3, PROC_EVENT_EXIT, &exitProcEvent{
+			ProcessPid: uint32(child), ProcessTgid: uint32(child), ExitCode: 3 << 8,
+		})),
+	)
+
+	replayer := NewReplayer(recording)
+	w, err := NewWatcherSource(context.Background(), replayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Watch(parent, PROC_EVENT_ALL); err != nil {
+		t.Fatal(err)
+	}
+	replayer.Start()
+
+	events := &anyEvent{}
+	replayed := make(chan struct{})
+	go func() {
+		defer close(replayed)
+		for {
+			select {
+			case ev := <-w.Fork:
+				events.forks = append(events.forks, ev.ChildPid)
+			case ev := <-w.Exec:
+				events.execs = append(events.execs, ev.Pid)
+			case ev := <-w.Exit:
+				events.exits = append(events.exits, ev.Pid)
+				events.exitEvents = append(events.exitEvents, ev)
+			case err := <-w.Error:
+				events.errors = append(events.errors, err)
+			case <-w.Resync:
+				t.Error("Unexpected resync")
+			case <-replayer.Done():
+				return
+			case <-time.After(5 * time.Second):
+				t.Error("Timeout replaying events")
+				return
+			}
+		}
+	}()
+	<-replayed
+
+	// the watcher handled the last message before reading to the end
+	// of the recording, the exit of the followed fork removed its watch
+	if _, found := w.watchFlags(child); found {
+		t.Errorf("Expected watch for pid=%d to be removed", child)
+	}
+	if flags, _ := w.watchFlags(parent); flags != PROC_EVENT_ALL {
+		t.Errorf("Expected watch for pid=%d to be kept, flags=%x", parent, flags)
+	}
+
+	w.Close()
+	expectClosed(t, w)
+
+	if len(events.errors) != 0 {
+		t.Errorf("Unexpected errors %v", events.errors)
+	}
+	if expectEvents(t, 1, "forks", events.forks) {
+		expectEventPid(t, "fork", child, events.forks[0])
+	}
+	if expectEvents(t, 1, "execs", events.execs) {
+		expectEventPid(t, "exec", child, events.execs[0])
+	}
+	if expectEvents(t, 1, "exits", events.exits) {
+		expectEventPid(t, "exit", child, events.exits[0])
+		if events.exitEvents[0].ExitCode != 3 {
+			t.Errorf("Expected exit code 3, received=%+v", events.exitEvents[0])
+		}
+	}
+}
+
+func TestReplayThreads(t *testing.T) {
+	// the parent of a thread is the parent of its process
+	parent, pid, tid := 1<<22, 1<<22+1, 1<<22+2
+
+	recording := record(t,
+		netlinkMessage(eventData(0, 1, PROC_EVENT_FORK, &forkProcEvent{
+			ParentPid: uint32(parent), ParentTgid: uint32(parent),
+			ChildPid: uint32(tid), ChildTgid: uint32(pid),
+		})),
+		netlinkMessage(eventData(0, 2, PROC_EVENT_EXIT, &exitProcEvent{
+			ProcessPid: uint32(tid), ProcessTgid: uint32(pid),
+		})),
+		netlinkMessage(exitEventData(0, 3, pid)),
+	)
+
+	replayer := NewReplayer(recording)
+	w, err := NewWatcherSource(context.Background(), replayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := w.Watch(parent, PROC_EVENT_ALL); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Watch(pid, PROC_EVENT_EXIT|PROC_EVENT_THREADS); err != nil {
+		t.Fatal(err)
+	}
+	replayer.Start()
+
+	var clones []*ProcEventClone
+	var threadExits []*ProcEventThreadExit
+	var exits []*ProcEventExit
+	for done := false; !done; {
+		select {
+		case ev := <-w.Fork:
+			t.Errorf("Unexpected fork event %+v", ev)
+		case ev := <-w.Clone:
+			clones = append(clones, ev)
+		case ev := <-w.ThreadExit:
+			threadExits = append(threadExits, ev)
+		case ev := <-w.Exit:
+			exits = append(exits, ev)
+		case err := <-w.Error:
+			t.Error(err)
+		case <-replayer.Done():
+			done = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout replaying events")
+		}
+	}
+
+	if len(clones) != 1 || clones[0].Pid != pid || clones[0].Tid != tid {
+		t.Errorf("Expected clone of tid=%d, received=%+v", tid, clones)
+	}
+	if len(threadExits) != 1 || threadExits[0].Pid != pid || threadExits[0].Tid != tid {
+		t.Errorf("Expected exit of tid=%d, received=%+v", tid, threadExits)
+	}
+	// the watch of the process was kept after the thread exit,
+	// so the exit of the process is sent and removes it
+	if len(exits) != 1 || exits[0].Pid != pid || exits[0].Tid != pid {
+		t.Errorf("Expected exit of pid=%d, received=%+v", pid, exits)
+	}
+	if _, found := w.watchFlags(pid); found {
+		t.Errorf("Expected watch for pid=%d to be removed", pid)
+	}
+	if flags, _ := w.watchFlags(parent); flags != PROC_EVENT_ALL {
+		t.Errorf("Expected watch for pid=%d to be kept, flags=%x", parent, flags)
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright (c) 2012 VMware, Inc.
+
+// +build !mips,!mipsle,!mips64,!mips64le,!mips64p32,!mips64p32le
+
+package psnotify
+
+// asm-generic/unistd.h: pidfd_open(). The syscalls added since Linux 5.1
+// have the same number on all the architectures supported by Go but MIPS,
+// whose ABIs offset them.
+const sysPidfdOpen = 434
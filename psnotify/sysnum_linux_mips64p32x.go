@@ -0,0 +1,9 @@
+// Copyright (c) 2012 VMware, Inc.
+
+// +build mips64p32 mips64p32le
+// +build linux
+
+package psnotify
+
+// arch/mips/kernel/syscalls/syscall_n32.tbl: pidfd_open(), offset by 6000.
+const sysPidfdOpen = 6434
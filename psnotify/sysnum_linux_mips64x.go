@@ -0,0 +1,9 @@
+// Copyright (c) 2012 VMware, Inc.
+
+// +build mips64 mips64le
+// +build linux
+
+package psnotify
+
+// arch/mips/kernel/syscalls/syscall_n64.tbl: pidfd_open(), offset by 5000.
+const sysPidfdOpen = 5434
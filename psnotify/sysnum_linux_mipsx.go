@@ -0,0 +1,9 @@
+// Copyright (c) 2012 VMware, Inc.
+
+// +build mips mipsle
+// +build linux
+
+package psnotify
+
+// arch/mips/kernel/syscalls/syscall_o32.tbl: pidfd_open(), offset by 4000.
+const sysPidfdOpen = 4434
@@ -0,0 +1,285 @@
+// Copyright (c) 2012 VMware, Inc.
+
+package psnotify
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/elastic/gosigar"
+)
+
+// Process is an entry of a ProcessTable.
+type Process struct {
+	Pid       int
+	Ppid      int
+	StartTime uint64   // Start time in milliseconds since the epoch, as in gosigar.ProcTime
+	Name      string   // Command name, as in gosigar.ProcState
+	Args      []string // Command line, captured when the process called exec()
+
+	Exited      bool
+	ExitTime    time.Time // Time the exit event was handled
+	ExitCode    int
+	Signal      syscall.Signal
+	CoreDumped  bool
+	StatusKnown bool // False if the exit status is unknown, see ProcEventExit
+}
+
+// Returns a copy of proc that does not share its Args.
+func (proc *Process) copy() Process {
+	c := *proc
+	c.Args = append([]string(nil), proc.Args...)
+	return c
+}
+
+// ProcessTable is a map of the running processes kept up to date with the
+// fork, exec and exit events of a Watcher, see Run(). Exited processes are
+// kept for the retention period. A ProcessTable is safe for concurrent use.
+type ProcessTable struct {
+	mu        sync.RWMutex
+	procs     map[int]*Process // Running processes by pid
+	exited    []*Process       // Exited processes, oldest first
+	retention time.Duration
+	now       func() time.Time
+}
+
+// Creates a ProcessTable seeded with the running processes. Exited
+// processes are kept for the retention period, or not at all when zero.
+func NewProcessTable(retention time.Duration) (*ProcessTable, error) {
+	t := &ProcessTable{
+		retention: retention,
+		now:       time.Now,
+	}
+	if err := t.seed(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reads the running processes with gosigar, replacing the table.
+func (t *ProcessTable) seed() error {
+	list := gosigar.ProcList{}
+	if err := list.Get(); err != nil {
+		return err
+	}
+
+	procs := make(map[int]*Process, len(list.List))
+	for _, pid := range list.List {
+		state := gosigar.ProcState{}
+		// the process exited since the list was read
+		if err := state.Get(pid); err != nil {
+			continue
+		}
+
+		proc := &Process{Pid: pid, Ppid: state.Ppid, Name: state.Name}
+		proc.readStartTime()
+		proc.readArgs()
+		procs[pid] = proc
+	}
+
+	t.mu.Lock()
+	t.procs = procs
+	t.mu.Unlock()
+
+	return nil
+}
+
+func (proc *Process) readStartTime() {
+	ptime := gosigar.ProcTime{}
+	if err := ptime.Get(proc.Pid); err == nil {
+		proc.StartTime = ptime.StartTime
+	}
+}
+
+func (proc *Process) readArgs() {
+	args := gosigar.ProcArgs{}
+	if err := args.Get(proc.Pid); err == nil {
+		proc.Args = args.List
+	}
+}
+
+// Update the table from the fork, exec and exit events of w until
+// ctx is cancelled or the event channels are closed. The table is
+// seeded again on resync events. The processes must be watched, e.g. with
+// w.WatchAll(PROC_EVENT_ALL, nil). Errors of w are not read by Run(),
+// the caller must read the Error channel.
+func (t *ProcessTable) Run(ctx context.Context, w *Watcher) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-w.Fork:
+			if !ok {
+				return nil
+			}
+			t.Handle(ev)
+		case ev, ok := <-w.Exec:
+			if !ok {
+				return nil
+			}
+			t.Handle(ev)
+		case ev, ok := <-w.Exit:
+			if !ok {
+				return nil
+			}
+			t.Handle(ev)
+		case _, ok := <-w.Resync:
+			if !ok {
+				return nil
+			}
+			if err := t.seed(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Update the table with a *ProcEventFork, *ProcEventExec or
+// *ProcEventExit. Other events are ignored.
+func (t *ProcessTable) Handle(ev interface{}) {
+	switch ev := ev.(type) {
+	case *ProcEventFork:
+		// new threads are reported with the pid and the parent of their process
+		if ev.ChildTid != 0 && ev.ChildTid != ev.ChildPid {
+			return
+		}
+
+		// the child runs the program of its parent until it calls exec()
+		proc := &Process{Pid: ev.ChildPid, Ppid: ev.ParentPid}
+		proc.readStartTime()
+
+		t.mu.Lock()
+		if parent, found := t.procs[ev.ParentPid]; found {
+			proc.Name = parent.Name
+			proc.Args = append([]string(nil), parent.Args...)
+		}
+		t.procs[ev.ChildPid] = proc
+		t.mu.Unlock()
+	case *ProcEventExec:
+		// read before a short-lived process vanishes
+		state := gosigar.ProcState{}
+		stateErr := state.Get(ev.Pid)
+		args := gosigar.ProcArgs{}
+		argsErr := args.Get(ev.Pid)
+
+		t.mu.Lock()
+		proc, found := t.procs[ev.Pid]
+		if !found {
+			proc = &Process{Pid: ev.Pid, Ppid: state.Ppid}
+			proc.readStartTime()
+			t.procs[ev.Pid] = proc
+		}
+		if stateErr == nil {
+			proc.Name = state.Name
+		}
+		if argsErr == nil {
+			proc.Args = args.List
+		}
+		t.mu.Unlock()
+	case *ProcEventExit:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		proc, found := t.procs[ev.Pid]
+		if !found {
+			proc = &Process{Pid: ev.Pid}
+		}
+		delete(t.procs, ev.Pid)
+
+		proc.Exited = true
+		proc.ExitTime = t.now()
+		proc.ExitCode = ev.ExitCode
+		proc.Signal = ev.Signal
+		proc.CoreDumped = ev.CoreDumped
+		proc.StatusKnown = ev.StatusKnown
+
+		if t.retention > 0 {
+			t.exited = append(t.exited, proc)
+		}
+		t.prune()
+	}
+}
+
+// Removes the exited processes older than the retention
+// period, must be called with t.mu held for writing.
+func (t *ProcessTable) prune() {
+	deadline := t.now().Add(-t.retention)
+
+	n := 0
+	for n < len(t.exited) && !t.exited[n].ExitTime.After(deadline) {
+		n++
+	}
+	if n > 0 {
+		t.exited = append(t.exited[:0], t.exited[n:]...)
+	}
+}
+
+// Returns a copy of the running process with the given pid.
+func (t *ProcessTable) Get(pid int) (Process, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	proc, found := t.procs[pid]
+	if !found {
+		return Process{}, false
+	}
+	return proc.copy(), true
+}
+
+// Returns the running children of pid, sorted by pid.
+func (t *ProcessTable) Children(pid int) []Process {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var children []Process
+	for _, proc := range t.procs {
+		if proc.Ppid == pid && proc.Pid != pid {
+			children = append(children, proc.copy())
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Pid < children[j].Pid
+	})
+	return children
+}
+
+// Returns the running ancestors of pid, starting with its parent.
+func (t *ProcessTable) Ancestors(pid int) []Process {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var ancestors []Process
+	seen := map[int]bool{pid: true}
+
+	proc, found := t.procs[pid]
+	for found {
+		ppid := proc.Ppid
+		if seen[ppid] {
+			break
+		}
+		seen[ppid] = true
+
+		proc, found = t.procs[ppid]
+		if found {
+			ancestors = append(ancestors, proc.copy())
+		}
+	}
+	return ancestors
+}
+
+// Returns the processes that exited within the retention period, oldest first.
+func (t *ProcessTable) Exited() []Process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune()
+
+	exited := make([]Process, len(t.exited))
+	for i, proc := range t.exited {
+		exited[i] = proc.copy()
+	}
+	return exited
+}
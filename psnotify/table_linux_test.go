@@ -0,0 +1,97 @@
+package psnotify
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProcessTable(t *testing.T) {
+	table, err := NewProcessTable(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1000, 0)
+	table.now = func() time.Time { return now }
+
+	pid := os.Getpid()
+	self, found := table.Get(pid)
+	if !found {
+		t.Fatalf("Expected pid=%d in the seeded table", pid)
+	}
+	if self.Ppid != os.Getppid() || self.StartTime == 0 || len(self.Args) == 0 {
+		t.Errorf("Expected seeded process attributes, received=%+v", self)
+	}
+
+	ancestors := table.Ancestors(pid)
+	if len(ancestors) == 0 || ancestors[0].Pid != os.Getppid() {
+		t.Errorf("Expected parent pid=%d first, received=%+v", os.Getppid(), ancestors)
+	}
+
+	// pids that don't exist, so exec can't read their attributes
+	child := 1 << 22
+	grandchild := child + 1
+
+	table.Handle(&ProcEventFork{ParentPid: pid, ChildPid: child, ChildTid: child})
+	table.procs[child].StartTime = 1
+	// a thread created by child, as reported by the kernel
+	table.Handle(&ProcEventFork{ParentPid: pid, ChildPid: child, ChildTid: child + 2})
+	if proc, _ := table.Get(child); proc.StartTime != 1 {
+		t.Errorf("Expected pid=%d to be kept after a thread fork, received=%+v", child, proc)
+	}
+	table.Handle(&ProcEventFork{ParentPid: child, ChildPid: grandchild, ChildTid: grandchild})
+	table.Handle(&ProcEventExec{Pid: grandchild})
+
+	proc, found := table.Get(grandchild)
+	if !found {
+		t.Fatalf("Expected pid=%d after fork", grandchild)
+	}
+	if proc.Name != self.Name || len(proc.Args) != len(self.Args) {
+		t.Errorf("Expected the name and args of the parent, received=%+v", proc)
+	}
+
+	// the returned args are a copy
+	proc.Args[0] = "changed"
+	if proc, _ := table.Get(grandchild); proc.Args[0] == "changed" {
+		t.Errorf("Expected the args of pid=%d to be copied, received=%+v", grandchild, proc)
+	}
+
+	children := table.Children(child)
+	if len(children) != 1 || children[0].Pid != grandchild {
+		t.Errorf("Expected child pid=%d, received=%+v", grandchild, children)
+	}
+
+	ancestors = table.Ancestors(grandchild)
+	if len(ancestors) < 2 || ancestors[0].Pid != child || ancestors[1].Pid != pid {
+		t.Errorf("Expected ancestors pid=%d,%d, received=%+v", child, pid, ancestors)
+	}
+
+	table.Handle(&ProcEventExit{Pid: grandchild, Signal: syscall.SIGKILL, StatusKnown: true})
+	now = now.Add(30 * time.Second)
+	table.Handle(&ProcEventExit{Pid: child})
+
+	if _, found := table.Get(child); found {
+		t.Errorf("Expected pid=%d to be removed after exit", child)
+	}
+
+	exited := table.Exited()
+	if len(exited) != 2 {
+		t.Fatalf("Expected 2 exited processes, received=%+v", exited)
+	}
+	if exited[0].Pid != grandchild || exited[0].Signal != syscall.SIGKILL || !exited[0].Exited || !exited[0].StatusKnown {
+		t.Errorf("Expected pid=%d killed, received=%+v", grandchild, exited[0])
+	}
+	// e.g. polled, so not the same as an exit code of 0
+	if exited[1].Pid != child || exited[1].ExitCode != 0 || exited[1].StatusKnown {
+		t.Errorf("Expected pid=%d with an unknown exit status, received=%+v", child, exited[1])
+	}
+
+	// the first exit is past the retention period
+	now = now.Add(45 * time.Second)
+	exited = table.Exited()
+	if len(exited) != 1 || exited[0].Pid != child {
+		t.Errorf("Expected pid=%d to be retained, received=%+v", child, exited)
+	}
+}
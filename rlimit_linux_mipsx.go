@@ -0,0 +1,24 @@
+// +build mips mipsle mips64 mips64le
+// +build linux
+
+package gosigar
+
+// arch/mips/include/uapi/asm/resource.h, in the order of RlimitResource.
+var rlimitNumbers = [numRlimits]uintptr{
+	0,  // RLIMIT_CPU
+	1,  // RLIMIT_FSIZE
+	2,  // RLIMIT_DATA
+	3,  // RLIMIT_STACK
+	4,  // RLIMIT_CORE
+	7,  // RLIMIT_RSS
+	8,  // RLIMIT_NPROC
+	5,  // RLIMIT_NOFILE
+	9,  // RLIMIT_MEMLOCK
+	6,  // RLIMIT_AS
+	10, // RLIMIT_LOCKS
+	11, // RLIMIT_SIGPENDING
+	12, // RLIMIT_MSGQUEUE
+	13, // RLIMIT_NICE
+	14, // RLIMIT_RTPRIO
+	15, // RLIMIT_RTTIME
+}
@@ -338,6 +338,22 @@ func (self *ProcFDUsage) Get(pid int) error {
 	return ErrNotImplemented{runtime.GOOS}
 }
 
+func (self *ProcIO) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcSched) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcLimits) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func SetProcLimit(pid int, resource RlimitResource, limit Rlimit) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
 // wrapper around sysctl KERN_PROCARGS2
 // callbacks params are optional,
 // up to the caller as to which pieces of data they want
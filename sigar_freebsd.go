@@ -4,6 +4,7 @@ package gosigar
 
 import (
 	"io/ioutil"
+	"runtime"
 	"strconv"
 	"strings"
 	"unsafe"
@@ -30,8 +31,12 @@ func init() {
 	getLinuxBootTime()
 }
 
-func getMountTableFileName() string {
-	return Procd + "/mtab"
+func getMountTableFileName(s *ConcreteSigar) string {
+	return s.procd() + "/mtab"
+}
+
+func (self *Uptime) get(s *ConcreteSigar) error {
+	return self.Get()
 }
 
 func (self *Uptime) Get() error {
@@ -46,6 +51,11 @@ func (self *Uptime) Get() error {
 	return nil
 }
 
+// kern.openfiles is not read from a filesystem root
+func (self *FDUsage) get(s *ConcreteSigar) error {
+	return self.Get()
+}
+
 func (self *FDUsage) Get() error {
 	val := C.uint32_t(0)
 	sc := C.size_t(4)
@@ -72,6 +82,11 @@ func (self *FDUsage) Get() error {
 }
 
 func (self *ProcFDUsage) Get(pid int) error {
+	return self.get(defaultSigar, pid)
+}
+
+func (self *ProcFDUsage) get(s *ConcreteSigar, pid int) error {
+	// the native procfs provides the limits
 	err := readFile("/proc/"+strconv.Itoa(pid)+"/rlimit", func(line string) bool {
 		if strings.HasPrefix(line, "nofile") {
 			fields := strings.Fields(line)
@@ -88,7 +103,7 @@ func (self *ProcFDUsage) Get(pid int) error {
 	}
 
 	// linprocfs only provides this information for this process (self).
-	fds, err := ioutil.ReadDir(procFileName(pid, "fd"))
+	fds, err := ioutil.ReadDir(s.procFileName(pid, "fd"))
 	if err != nil {
 		return err
 	}
@@ -97,6 +112,40 @@ func (self *ProcFDUsage) Get(pid int) error {
 	return nil
 }
 
+func (self *ProcIO) Get(pid int) error {
+	return self.get(defaultSigar, pid)
+}
+
+// linprocfs doesn't provide the I/O counters of processes.
+func (self *ProcIO) get(s *ConcreteSigar, pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcSched) Get(pid int) error {
+	return self.get(defaultSigar, pid)
+}
+
+func (self *ProcSched) get(s *ConcreteSigar, pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcLimits) Get(pid int) error {
+	return self.get(defaultSigar, pid)
+}
+
+func (self *ProcLimits) get(s *ConcreteSigar, pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func SetProcLimit(pid int, resource RlimitResource, limit Rlimit) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+// linprocfs doesn't report the controlling terminal.
+func (s *ConcreteSigar) ttyName(tty int, lookups *procLookups) string {
+	return ""
+}
+
 func parseCpuStat(self *Cpu, line string) error {
 	fields := strings.Fields(line)
 
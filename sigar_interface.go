@@ -1,6 +1,7 @@
 package gosigar
 
 import (
+	"strconv"
 	"time"
 )
 
@@ -28,6 +29,19 @@ type Sigar interface {
 	GetSwap() (Swap, error)
 	GetFileSystemUsage(string) (FileSystemUsage, error)
 	GetFDUsage() (FDUsage, error)
+	GetCpuList() (CpuList, error)
+	GetUptime() (Uptime, error)
+	GetFileSystemList() (FileSystemList, error)
+	GetProcList() (ProcList, error)
+	GetProcState(pid int) (ProcState, error)
+	GetProcMem(pid int) (ProcMem, error)
+	GetProcTime(pid int) (ProcTime, error)
+	GetProcArgs(pid int) (ProcArgs, error)
+	GetProcExe(pid int) (ProcExe, error)
+	GetProcFDUsage(pid int) (ProcFDUsage, error)
+	GetProcIO(pid int) (ProcIO, error)
+	GetProcSched(pid int) (ProcSched, error)
+	GetProcLimits(pid int) (ProcLimits, error)
 }
 
 type Cpu struct {
@@ -138,6 +152,45 @@ type ProcState struct {
 	Priority  int
 	Nice      int
 	Processor int
+
+	Sid        int
+	Tpgid      int    // Foreground process group of the controlling terminal
+	TtyName    string // Controlling terminal, e.g. /dev/pts/0, empty if there is none
+	NumThreads int
+
+	UIDs   ProcIDs
+	GIDs   ProcIDs
+	Groups []ProcID // Supplementary groups
+
+	VoluntaryCtxtSwitches    uint64
+	NonvoluntaryCtxtSwitches uint64
+
+	TracerPid int   // Pid of the process tracing this one, zero if not traced
+	NSpid     []int // Pid in each nested pid namespace, outermost first
+	NStgid    []int // Thread group id in each nested pid namespace, outermost first
+
+	// Signal masks, bit n-1 is set for signal n
+	SigPending uint64
+	SigBlocked uint64
+	SigIgnored uint64
+	SigCaught  uint64
+}
+
+// ProcID is a user or group id with its name, or the id
+// formatted as a string if it has no name. Names are read from the passwd
+// and group files of Options.EtcRoot if it is set, otherwise they are
+// looked up in the user and group databases of the caller.
+type ProcID struct {
+	ID   int
+	Name string
+}
+
+// ProcIDs holds the user or group ids of a process.
+type ProcIDs struct {
+	Real      ProcID
+	Effective ProcID
+	Saved     ProcID
+	FS        ProcID // Used for filesystem access checks
 }
 
 type ProcMem struct {
@@ -149,11 +202,29 @@ type ProcMem struct {
 	PageFaults  uint64
 }
 
+// ProcTime holds the CPU times of a process in milliseconds. The *Nanos
+// fields hold the times with the precision of the kernel, only on Linux.
 type ProcTime struct {
-	StartTime uint64
-	User      uint64
-	Sys       uint64
-	Total     uint64
+	StartTime    uint64 // Milliseconds since the epoch, whole seconds on Linux
+	User         uint64
+	Sys          uint64
+	Total        uint64
+	ChildrenUser uint64 // User time of the children that were waited for
+	ChildrenSys  uint64 // System time of the children that were waited for
+
+	StartTimeNanos     uint64 // Nanoseconds since the epoch
+	UserNanos          uint64
+	SysNanos           uint64
+	ChildrenUserNanos  uint64
+	ChildrenSysNanos   uint64
+	GuestNanos         uint64 // Time running a virtual CPU for a guest, included in UserNanos
+	ChildrenGuestNanos uint64
+	BlkioDelayNanos    uint64 // Time waiting for block I/O, requires delay accounting
+
+	// From schedstat, to spot processes starved of CPU
+	RunNanos      uint64 // Time spent on a CPU
+	RunDelayNanos uint64 // Time spent waiting on a run queue
+	Timeslices    uint64 // Number of times the process was run on a CPU
 }
 
 type ProcArgs struct {
@@ -171,3 +242,231 @@ type ProcFDUsage struct {
 	SoftLimit uint64
 	HardLimit uint64
 }
+
+// ProcIO holds the cumulative I/O counters of a process.
+type ProcIO struct {
+	ReadChar            uint64 // Bytes read by read() and similar syscalls
+	WriteChar           uint64 // Bytes written by write() and similar syscalls
+	ReadSyscalls        uint64
+	WriteSyscalls       uint64
+	ReadBytes           uint64 // Bytes fetched from the storage layer
+	WriteBytes          uint64 // Bytes sent to the storage layer
+	CancelledWriteBytes uint64 // Bytes of truncated dirty pages that were not written
+}
+
+// RlimitInfinity is the value of an unlimited resource limit.
+const RlimitInfinity = ^uint64(0)
+
+// RlimitResource is a resource of setrlimit(). The values follow the
+// generic Linux ABI and are mapped to the numbers of the architecture,
+// which differ on MIPS and SPARC, when calling prlimit().
+type RlimitResource int
+
+const (
+	RlimitCPU              RlimitResource = iota // Seconds
+	RlimitFileSize                               // Bytes
+	RlimitData                                   // Bytes
+	RlimitStack                                  // Bytes
+	RlimitCore                                   // Bytes
+	RlimitResident                               // Bytes
+	RlimitProcesses                              // Processes
+	RlimitOpenFiles                              // Files
+	RlimitLockedMemory                           // Bytes
+	RlimitAddressSpace                           // Bytes
+	RlimitFileLocks                              // Locks
+	RlimitPendingSignals                         // Signals
+	RlimitMsgqueueSize                           // Bytes
+	RlimitNicePriority                           // Ceiling of 20 - nice
+	RlimitRealtimePriority                       // Priority
+	RlimitRealtimeTimeout                        // Microseconds
+
+	numRlimits = int(RlimitRealtimeTimeout) + 1
+)
+
+var rlimitNames = [numRlimits]string{
+	"Max cpu time",
+	"Max file size",
+	"Max data size",
+	"Max stack size",
+	"Max core file size",
+	"Max resident set",
+	"Max processes",
+	"Max open files",
+	"Max locked memory",
+	"Max address space",
+	"Max file locks",
+	"Max pending signals",
+	"Max msgqueue size",
+	"Max nice priority",
+	"Max realtime priority",
+	"Max realtime timeout",
+}
+
+var rlimitUnits = [numRlimits]string{
+	"seconds", "bytes", "bytes", "bytes", "bytes", "bytes", "processes", "files",
+	"bytes", "bytes", "locks", "signals", "bytes", "", "", "us",
+}
+
+// String returns the name of the resource, as in /proc/[pid]/limits.
+func (r RlimitResource) String() string {
+	if r < 0 || int(r) >= numRlimits {
+		return "RLIMIT_" + strconv.Itoa(int(r))
+	}
+	return rlimitNames[r]
+}
+
+// Unit returns the unit of the resource, as in /proc/[pid]/limits.
+// It is empty for the priorities.
+func (r RlimitResource) Unit() string {
+	if r < 0 || int(r) >= numRlimits {
+		return ""
+	}
+	return rlimitUnits[r]
+}
+
+// Rlimit holds the soft and hard limit of a resource,
+// RlimitInfinity when unlimited.
+type Rlimit struct {
+	Soft uint64
+	Hard uint64
+}
+
+// ProcLimits holds the resource limits of a process.
+type ProcLimits struct {
+	CPU              Rlimit
+	FileSize         Rlimit
+	Data             Rlimit
+	Stack            Rlimit
+	Core             Rlimit
+	Resident         Rlimit
+	Processes        Rlimit
+	OpenFiles        Rlimit
+	LockedMemory     Rlimit
+	AddressSpace     Rlimit
+	FileLocks        Rlimit
+	PendingSignals   Rlimit
+	MsgqueueSize     Rlimit
+	NicePriority     Rlimit
+	RealtimePriority Rlimit
+	RealtimeTimeout  Rlimit
+}
+
+// Limit returns the limit of resource r.
+func (self *ProcLimits) Limit(r RlimitResource) Rlimit {
+	if limit := self.limit(r); limit != nil {
+		return *limit
+	}
+	return Rlimit{}
+}
+
+func (self *ProcLimits) limit(r RlimitResource) *Rlimit {
+	switch r {
+	case RlimitCPU:
+		return &self.CPU
+	case RlimitFileSize:
+		return &self.FileSize
+	case RlimitData:
+		return &self.Data
+	case RlimitStack:
+		return &self.Stack
+	case RlimitCore:
+		return &self.Core
+	case RlimitResident:
+		return &self.Resident
+	case RlimitProcesses:
+		return &self.Processes
+	case RlimitOpenFiles:
+		return &self.OpenFiles
+	case RlimitLockedMemory:
+		return &self.LockedMemory
+	case RlimitAddressSpace:
+		return &self.AddressSpace
+	case RlimitFileLocks:
+		return &self.FileLocks
+	case RlimitPendingSignals:
+		return &self.PendingSignals
+	case RlimitMsgqueueSize:
+		return &self.MsgqueueSize
+	case RlimitNicePriority:
+		return &self.NicePriority
+	case RlimitRealtimePriority:
+		return &self.RealtimePriority
+	case RlimitRealtimeTimeout:
+		return &self.RealtimeTimeout
+	}
+	return nil
+}
+
+// SchedPolicy is a scheduling policy of sched_setscheduler().
+type SchedPolicy int
+
+const (
+	SchedOther    SchedPolicy = 0
+	SchedFIFO     SchedPolicy = 1
+	SchedRR       SchedPolicy = 2
+	SchedBatch    SchedPolicy = 3
+	SchedIdle     SchedPolicy = 5
+	SchedDeadline SchedPolicy = 6
+)
+
+func (p SchedPolicy) String() string {
+	switch p {
+	case SchedOther:
+		return "SCHED_OTHER"
+	case SchedFIFO:
+		return "SCHED_FIFO"
+	case SchedRR:
+		return "SCHED_RR"
+	case SchedBatch:
+		return "SCHED_BATCH"
+	case SchedIdle:
+		return "SCHED_IDLE"
+	case SchedDeadline:
+		return "SCHED_DEADLINE"
+	}
+	return "SCHED_" + strconv.Itoa(int(p))
+}
+
+// IOPrioClass is an I/O scheduling class of ioprio_set().
+type IOPrioClass int
+
+const (
+	IOPrioClassNone IOPrioClass = 0 // Derived from the nice value, as best-effort
+	IOPrioClassRT   IOPrioClass = 1
+	IOPrioClassBE   IOPrioClass = 2
+	IOPrioClassIdle IOPrioClass = 3
+)
+
+func (c IOPrioClass) String() string {
+	switch c {
+	case IOPrioClassNone:
+		return "none"
+	case IOPrioClassRT:
+		return "realtime"
+	case IOPrioClassBE:
+		return "best-effort"
+	case IOPrioClassIdle:
+		return "idle"
+	}
+	return strconv.Itoa(int(c))
+}
+
+// ProcSched holds the scheduling settings of a process, as set with
+// chrt, taskset, numactl and ionice. See ProcState for the nice value.
+// With a custom proc root, see Options, ResetOnFork and the I/O priority
+// are not read.
+type ProcSched struct {
+	Policy      SchedPolicy
+	ResetOnFork bool  // Children are reset to SCHED_OTHER
+	RtPriority  int   // From 1 to 99 for SCHED_FIFO and SCHED_RR, zero otherwise
+	Affinity    []int // CPUs the process may run on
+
+	MemPolicy   string // NUMA policy of the process from numa_maps, e.g. default or interleave:0-1
+	MemsAllowed []int  // NUMA nodes the process may allocate memory on
+
+	IOPrioClass IOPrioClass
+	IOPrioLevel int // From 0, the highest, to 7
+
+	AutogroupID   int // Zero without CONFIG_SCHED_AUTOGROUP
+	AutogroupNice int
+}
@@ -3,22 +3,32 @@
 package gosigar
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
 	"strconv"
 	"strings"
 	"syscall"
+	"unsafe"
+
+	"github.com/elastic/gosigar/util"
 )
 
 func init() {
-	system.ticks = 100 // C.sysconf(C._SC_CLK_TCK)
+	system.ticks = uint64(util.GetClockTicks())
 
 	Procd = "/proc"
 
 	getLinuxBootTime()
 }
 
-func getMountTableFileName() string {
-	return "/etc/mtab"
+func getMountTableFileName(s *ConcreteSigar) string {
+	return s.etcd() + "/mtab"
+}
+
+// the uptime of the kernel doesn't depend on the filesystem roots
+func (self *Uptime) get(s *ConcreteSigar) error {
+	return self.Get()
 }
 
 func (self *Uptime) Get() error {
@@ -34,7 +44,11 @@ func (self *Uptime) Get() error {
 }
 
 func (self *FDUsage) Get() error {
-	return readFile(Procd+"/sys/fs/file-nr", func(line string) bool {
+	return self.get(defaultSigar)
+}
+
+func (self *FDUsage) get(s *ConcreteSigar) error {
+	return readFile(s.procd()+"/sys/fs/file-nr", func(line string) bool {
 		fields := strings.Fields(line)
 		if len(fields) == 3 {
 			self.Open, _ = strconv.ParseUint(fields[0], 10, 64)
@@ -46,7 +60,11 @@ func (self *FDUsage) Get() error {
 }
 
 func (self *ProcFDUsage) Get(pid int) error {
-	err := readFile(procFileName(pid, "limits"), func(line string) bool {
+	return self.get(defaultSigar, pid)
+}
+
+func (self *ProcFDUsage) get(s *ConcreteSigar, pid int) error {
+	err := readFile(s.procFileName(pid, "limits"), func(line string) bool {
 		if strings.HasPrefix(line, "Max open files") {
 			fields := strings.Fields(line)
 			if len(fields) == 6 {
@@ -60,7 +78,7 @@ func (self *ProcFDUsage) Get(pid int) error {
 	if err != nil {
 		return err
 	}
-	fds, err := ioutil.ReadDir(procFileName(pid, "fd"))
+	fds, err := ioutil.ReadDir(s.procFileName(pid, "fd"))
 	if err != nil {
 		return err
 	}
@@ -68,6 +86,325 @@ func (self *ProcFDUsage) Get(pid int) error {
 	return nil
 }
 
+func (self *ProcIO) Get(pid int) error {
+	return self.get(defaultSigar, pid)
+}
+
+// Reads /proc/[pid]/io, which requires the permissions to ptrace the process.
+func (self *ProcIO) get(s *ConcreteSigar, pid int) error {
+	fields := map[string]*uint64{
+		"rchar":                 &self.ReadChar,
+		"wchar":                 &self.WriteChar,
+		"syscr":                 &self.ReadSyscalls,
+		"syscw":                 &self.WriteSyscalls,
+		"read_bytes":            &self.ReadBytes,
+		"write_bytes":           &self.WriteBytes,
+		"cancelled_write_bytes": &self.CancelledWriteBytes,
+	}
+
+	contents, err := s.readProcFile(pid, "io")
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if ptr := fields[parts[0]]; ptr != nil {
+			*ptr, _ = strtoull(strings.TrimSpace(parts[1]))
+		}
+	}
+
+	return nil
+}
+
+const (
+	// linux/sched.h: flag or'ed into the policy of sched_getscheduler()
+	schedResetOnFork = 0x40000000
+
+	// linux/ioprio.h
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioLevelMask  = 0x7
+)
+
+func (self *ProcSched) Get(pid int) error {
+	return self.get(defaultSigar, pid)
+}
+
+// The syscalls refer to pid in the pid namespace of the caller, so
+// with a custom proc root, whose processes may be of another namespace,
+// the settings are read from the proc files of the process instead.
+// ResetOnFork and the I/O priority are then left unset.
+func (self *ProcSched) get(s *ConcreteSigar, pid int) error {
+	if s.procRoot == "" {
+		if err := self.getSyscalls(pid); err != nil {
+			return err
+		}
+	} else if err := self.parseStat(s, pid); err != nil {
+		return err
+	}
+
+	status, err := s.getProcStatus(pid)
+	if err != nil {
+		if isProcessGone(err) {
+			return syscall.ESRCH
+		}
+		return err
+	}
+	if s.procRoot != "" {
+		self.Affinity, _ = util.ParseList(status["Cpus_allowed_list"])
+	}
+	self.MemsAllowed, _ = util.ParseList(status["Mems_allowed_list"])
+
+	// without NUMA or autogroup support the files don't exist
+	self.MemPolicy = s.getMemPolicy(pid)
+	self.getAutogroup(s, pid)
+
+	return nil
+}
+
+// Reads the policy and the realtime priority from /proc/[pid]/stat.
+func (self *ProcSched) parseStat(s *ConcreteSigar, pid int) error {
+	contents, err := s.readProcFile(pid, "stat")
+	if err != nil {
+		return err
+	}
+
+	fields := splitStat(contents)
+	if len(fields) < 41 {
+		return fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	self.RtPriority, _ = strconv.Atoi(fields[39])
+	policy, _ := strconv.Atoi(fields[40])
+	self.Policy = SchedPolicy(policy)
+
+	return nil
+}
+
+func (self *ProcSched) getSyscalls(pid int) error {
+	policy, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETSCHEDULER, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	self.Policy = SchedPolicy(policy &^ schedResetOnFork)
+	self.ResetOnFork = policy&schedResetOnFork != 0
+
+	var param struct{ priority int32 }
+	_, _, errno = syscall.RawSyscall(syscall.SYS_SCHED_GETPARAM, uintptr(pid), uintptr(unsafe.Pointer(&param)), 0)
+	if errno != 0 {
+		return errno
+	}
+	self.RtPriority = int(param.priority)
+
+	// enough for 4096 CPUs, the size is rounded down to whole words
+	mask := make([]uint64, 64)
+	size, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, uintptr(pid),
+		uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return errno
+	}
+	self.Affinity = nil
+	for i, word := range mask[:size/8] {
+		for bit := 0; bit < 64; bit++ {
+			if word&(1<<uint(bit)) != 0 {
+				self.Affinity = append(self.Affinity, i*64+bit)
+			}
+		}
+	}
+
+	ioprio, _, errno := syscall.RawSyscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(pid), 0)
+	if errno != 0 {
+		return errno
+	}
+	self.IOPrioClass = IOPrioClass(ioprio >> ioprioClassShift)
+	self.IOPrioLevel = int(ioprio & ioprioLevelMask)
+
+	return nil
+}
+
+// Reads the memory policy of the process from /proc/[pid]/numa_maps, e.g.
+// "00400000 default file=/usr/bin/cat mapped=8 N0=8 kernelpagesize_kB=4".
+// Mappings without a policy of their own, usually the first one, show the
+// policy of the process. Not all processes have a heap, e.g. Go programs.
+func (s *ConcreteSigar) getMemPolicy(pid int) string {
+	var policy string
+	readFile(s.procFileName(pid, "numa_maps"), func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) > 1 {
+			policy = fields[1]
+			return false
+		}
+		return true
+	})
+	return policy
+}
+
+// Reads /proc/[pid]/autogroup, e.g. "/autogroup-42 nice 0".
+func (self *ProcSched) getAutogroup(s *ConcreteSigar, pid int) {
+	contents, err := s.readProcFile(pid, "autogroup")
+	if err != nil {
+		return
+	}
+
+	fields := strings.Fields(string(contents))
+	if len(fields) != 3 || !strings.HasPrefix(fields[0], "/autogroup-") {
+		return
+	}
+	self.AutogroupID, _ = strconv.Atoi(strings.TrimPrefix(fields[0], "/autogroup-"))
+	self.AutogroupNice, _ = strconv.Atoi(fields[2])
+}
+
+func (self *ProcLimits) Get(pid int) error {
+	return self.get(defaultSigar, pid)
+}
+
+// Reads the limits with prlimit(), or from /proc/[pid]/limits if not
+// permitted. The file is always read with a custom proc root, whose
+// processes may not be visible to the syscalls.
+func (self *ProcLimits) get(s *ConcreteSigar, pid int) error {
+	if s.procRoot == "" {
+		limits := ProcLimits{}
+		err := limits.prlimit(pid)
+		if err == nil {
+			*self = limits
+			return nil
+		}
+		if err != syscall.EPERM && err != syscall.ENOSYS {
+			return err
+		}
+	}
+
+	return self.readLimits(s, pid)
+}
+
+func (self *ProcLimits) prlimit(pid int) error {
+	for r := 0; r < numRlimits; r++ {
+		if err := prlimit(pid, RlimitResource(r), nil, self.limit(RlimitResource(r))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parses /proc/[pid]/limits, e.g.
+// "Max open files            1024                 1048576              files".
+func (self *ProcLimits) readLimits(s *ConcreteSigar, pid int) error {
+	contents, err := s.readProcFile(pid, "limits")
+	if err != nil {
+		return err
+	}
+
+	resources := make(map[string]RlimitResource, numRlimits)
+	for r := 0; r < numRlimits; r++ {
+		resources[RlimitResource(r).String()] = RlimitResource(r)
+	}
+
+	// the names are padded to 26 characters
+	for _, line := range strings.Split(string(contents), "\n") {
+		if len(line) < 26 {
+			continue
+		}
+		r, found := resources[strings.TrimSpace(line[:26])]
+		if !found {
+			continue
+		}
+		fields := strings.Fields(line[26:])
+		if len(fields) < 2 {
+			return fmt.Errorf("malformed limits line %q for pid %d", line, pid)
+		}
+
+		limit := self.limit(r)
+		if limit.Soft, err = parseRlimit(fields[0]); err != nil {
+			return err
+		}
+		if limit.Hard, err = parseRlimit(fields[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseRlimit(val string) (uint64, error) {
+	if val == "unlimited" {
+		return RlimitInfinity, nil
+	}
+	return strtoull(val)
+}
+
+// SetProcLimit sets the limit of resource for the process pid, e.g. to
+// raise the open files limit of a running service. Raising a hard limit
+// requires CAP_SYS_RESOURCE, and setting the limits of a process of
+// another user requires the same capability.
+func SetProcLimit(pid int, resource RlimitResource, limit Rlimit) error {
+	if resource < 0 || int(resource) >= numRlimits {
+		return syscall.EINVAL
+	}
+	return prlimit(pid, resource, &limit, nil)
+}
+
+// linux/resource.h: struct rlimit64, as the Rlimit type. The resource
+// is mapped with rlimitNumbers.
+func prlimit(pid int, resource RlimitResource, newLimit, oldLimit *Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), rlimitNumbers[resource],
+		uintptr(unsafe.Pointer(newLimit)), uintptr(unsafe.Pointer(oldLimit)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Resolves the device number of a controlling terminal to its name, as
+// listed in Documentation/admin-guide/devices.txt, or by looking for the
+// device in devd().
+func (s *ConcreteSigar) ttyName(tty int, lookups *procLookups) string {
+	if tty == 0 {
+		return ""
+	}
+
+	major := (tty >> 8) & 0xfff
+	minor := (tty & 0xff) | ((tty >> 12) & 0xfff00)
+
+	switch {
+	case major >= 136 && major <= 143:
+		return "/dev/pts/" + strconv.Itoa((major-136)<<8+minor)
+	case major == 4 && minor < 64:
+		return "/dev/tty" + strconv.Itoa(minor)
+	case major == 4 && minor < 256:
+		return "/dev/ttyS" + strconv.Itoa(minor-64)
+	}
+
+	// e.g. /dev/console or /dev/ttyUSB0
+	rdev := mkdev(major, minor)
+	for _, dev := range lookups.devices(s) {
+		if dev.Mode()&os.ModeCharDevice == 0 {
+			continue
+		}
+		if stat, ok := dev.Sys().(*syscall.Stat_t); ok && uint64(stat.Rdev) == rdev {
+			return "/dev/" + dev.Name()
+		}
+	}
+
+	return ""
+}
+
+// Returns the files of devd(), which are read once.
+func (l *procLookups) devices(s *ConcreteSigar) []os.FileInfo {
+	l.devsOnce.Do(func() {
+		l.devs, _ = ioutil.ReadDir(s.devd())
+	})
+	return l.devs
+}
+
+// Encodes a device number as in the st_rdev of stat().
+func mkdev(major, minor int) uint64 {
+	return uint64(minor&0xff) | uint64(major&0xfff)<<8 |
+		uint64(minor&^0xff)<<12 | uint64(major&^0xfff)<<32
+}
+
 func parseCpuStat(self *Cpu, line string) error {
 	fields := strings.Fields(line)
 
@@ -26,19 +26,65 @@ var system struct {
 
 var Procd string
 
+// The default instance used by the Get methods, it
+// reads Procd at each call so the global can be changed.
+var defaultSigar = &ConcreteSigar{}
+
 func getLinuxBootTime() {
-	// grab system boot time
-	readFile(Procd+"/stat", func(line string) bool {
+	system.btime = readBootTime(Procd)
+}
+
+// grab system boot time
+func readBootTime(procd string) uint64 {
+	var btime uint64
+	readFile(procd+"/stat", func(line string) bool {
 		if strings.HasPrefix(line, "btime") {
-			system.btime, _ = strtoull(line[6:])
+			btime, _ = strtoull(line[6:])
 			return false // stop reading
 		}
 		return true
 	})
+	return btime
+}
+
+func (s *ConcreteSigar) procd() string {
+	if s.procRoot != "" {
+		return s.procRoot
+	}
+	return Procd
+}
+
+func (s *ConcreteSigar) etcd() string {
+	if s.etcRoot != "" {
+		return s.etcRoot
+	}
+	return "/etc"
+}
+
+func (s *ConcreteSigar) devd() string {
+	if s.devRoot != "" {
+		return s.devRoot
+	}
+	return "/dev"
+}
+
+// The boot time of the default instance is read once from Procd at init.
+func (s *ConcreteSigar) bootTime() uint64 {
+	if s.procRoot == "" {
+		return system.btime
+	}
+	s.btimeOnce.Do(func() {
+		s.btime = readBootTime(s.procRoot)
+	})
+	return s.btime
 }
 
 func (self *LoadAverage) Get() error {
-	line, err := ioutil.ReadFile(Procd + "/loadavg")
+	return self.get(defaultSigar)
+}
+
+func (self *LoadAverage) get(s *ConcreteSigar) error {
+	line, err := ioutil.ReadFile(s.procd() + "/loadavg")
 	if err != nil {
 		return nil
 	}
@@ -53,6 +99,10 @@ func (self *LoadAverage) Get() error {
 }
 
 func (self *Mem) Get() error {
+	return self.get(defaultSigar)
+}
+
+func (self *Mem) get(s *ConcreteSigar) error {
 	var buffers, cached uint64
 	table := map[string]*uint64{
 		"MemTotal": &self.Total,
@@ -61,7 +111,7 @@ func (self *Mem) Get() error {
 		"Cached":   &cached,
 	}
 
-	if err := parseMeminfo(table); err != nil {
+	if err := s.parseMeminfo(table); err != nil {
 		return err
 	}
 
@@ -74,12 +124,16 @@ func (self *Mem) Get() error {
 }
 
 func (self *Swap) Get() error {
+	return self.get(defaultSigar)
+}
+
+func (self *Swap) get(s *ConcreteSigar) error {
 	table := map[string]*uint64{
 		"SwapTotal": &self.Total,
 		"SwapFree":  &self.Free,
 	}
 
-	if err := parseMeminfo(table); err != nil {
+	if err := s.parseMeminfo(table); err != nil {
 		return err
 	}
 
@@ -88,7 +142,11 @@ func (self *Swap) Get() error {
 }
 
 func (self *Cpu) Get() error {
-	return readFile(Procd+"/stat", func(line string) bool {
+	return self.get(defaultSigar)
+}
+
+func (self *Cpu) get(s *ConcreteSigar) error {
+	return readFile(s.procd()+"/stat", func(line string) bool {
 		if len(line) > 4 && line[0:4] == "cpu " {
 			parseCpuStat(self, line)
 			return false
@@ -99,13 +157,17 @@ func (self *Cpu) Get() error {
 }
 
 func (self *CpuList) Get() error {
+	return self.get(defaultSigar)
+}
+
+func (self *CpuList) get(s *ConcreteSigar) error {
 	capacity := len(self.List)
 	if capacity == 0 {
 		capacity = 4
 	}
 	list := make([]Cpu, 0, capacity)
 
-	err := readFile(Procd+"/stat", func(line string) bool {
+	err := readFile(s.procd()+"/stat", func(line string) bool {
 		if len(line) > 3 && line[0:3] == "cpu" && line[3] != ' ' {
 			cpu := Cpu{}
 			parseCpuStat(&cpu, line)
@@ -120,13 +182,17 @@ func (self *CpuList) Get() error {
 }
 
 func (self *FileSystemList) Get() error {
+	return self.get(defaultSigar)
+}
+
+func (self *FileSystemList) get(s *ConcreteSigar) error {
 	capacity := len(self.List)
 	if capacity == 0 {
 		capacity = 10
 	}
 	fslist := make([]FileSystem, 0, capacity)
 
-	err := readFile(getMountTableFileName(), func(line string) bool {
+	err := readFile(getMountTableFileName(s), func(line string) bool {
 		fields := strings.Fields(line)
 
 		fs := FileSystem{}
@@ -146,7 +212,11 @@ func (self *FileSystemList) Get() error {
 }
 
 func (self *ProcList) Get() error {
-	dir, err := os.Open(Procd)
+	return self.get(defaultSigar)
+}
+
+func (self *ProcList) get(s *ConcreteSigar) error {
+	dir, err := os.Open(s.procd())
 	if err != nil {
 		return err
 	}
@@ -178,61 +248,226 @@ func (self *ProcList) Get() error {
 }
 
 func (self *ProcState) Get(pid int) error {
-	contents, err := readProcFile(pid, "stat")
+	return self.get(defaultSigar, pid)
+}
+
+func (self *ProcState) get(s *ConcreteSigar, pid int) error {
+	contents, err := s.readProcFile(pid, "stat")
 	if err != nil {
 		return err
 	}
 
-	headerAndStats := strings.SplitAfterN(string(contents), ")", 2)
-	pidAndName := headerAndStats[0]
-	fields := strings.Fields(headerAndStats[1])
+	lookups := newProcLookups(s)
+	if err := self.parseStat(s, pid, contents, lookups); err != nil {
+		return err
+	}
+
+	return self.getStatus(s, pid, lookups)
+}
+
+func (self *ProcState) parseStat(s *ConcreteSigar, pid int, contents []byte, lookups *procLookups) error {
+	// the name may contain spaces and parentheses
+	fields := splitStat(contents)
+	if len(fields) < 39 {
+		return errors.New(fmt.Sprintf("Malformed process stats for pid %d", pid))
+	}
 
-	name := strings.SplitAfterN(pidAndName, " ", 2)[1]
+	name := fields[1]
 	if name[0] == '(' && name[len(name)-1] == ')' {
 		self.Name = name[1 : len(name)-1] // strip ()'s
 	} else {
 		return errors.New(fmt.Sprintf("Malformed process stats for pid %d", pid))
 	}
 
-	self.State = RunState(fields[0][0])
+	self.State = RunState(fields[2][0])
 
-	self.Ppid, _ = strconv.Atoi(fields[1])
+	self.Ppid, _ = strconv.Atoi(fields[3])
 
-	self.Pgid, _ = strconv.Atoi(fields[2])
+	self.Pgid, _ = strconv.Atoi(fields[4])
 
-	self.Tty, _ = strconv.Atoi(fields[4])
+	self.Sid, _ = strconv.Atoi(fields[5])
 
-	self.Priority, _ = strconv.Atoi(fields[15])
+	self.Tty, _ = strconv.Atoi(fields[6])
+	self.TtyName = s.ttyName(self.Tty, lookups)
 
-	self.Nice, _ = strconv.Atoi(fields[16])
+	self.Tpgid, _ = strconv.Atoi(fields[7])
 
-	self.Processor, _ = strconv.Atoi(fields[36])
+	self.Priority, _ = strconv.Atoi(fields[17])
 
-	// Read /proc/[pid]/status to get the uid, then lookup uid to get username.
-	status, err := getProcStatus(pid)
+	self.Nice, _ = strconv.Atoi(fields[18])
+
+	self.NumThreads, _ = strconv.Atoi(fields[19])
+
+	self.Processor, _ = strconv.Atoi(fields[38])
+
+	return nil
+}
+
+func (self *ProcState) getStatus(s *ConcreteSigar, pid int, lookups *procLookups) error {
+	// Read /proc/[pid]/status to get the ids, then lookup uid to get username.
+	status, err := s.getProcStatus(pid)
 	if err != nil {
+		if isProcessGone(err) {
+			return syscall.ESRCH
+		}
 		return fmt.Errorf("failed to read process status for pid %d. %v", pid, err)
 	}
-	uids, err := getUIDs(status)
+	uids, err := getIDs(status, "Uid")
 	if err != nil {
 		return fmt.Errorf("failed to read process status for pid %d. %v", pid, err)
 	}
-	user, err := user.LookupId(uids[0])
-	if err == nil {
-		self.Username = user.Username
-	} else {
-		self.Username = uids[0]
+
+	self.UIDs = newProcIDs(uids, lookups.user)
+	self.Username = self.UIDs.Real.Name
+
+	if gids, err := getIDs(status, "Gid"); err == nil {
+		self.GIDs = newProcIDs(gids, lookups.group)
+	}
+	for _, gid := range strings.Fields(status["Groups"]) {
+		self.Groups = append(self.Groups, lookups.group(gid))
 	}
 
+	self.VoluntaryCtxtSwitches, _ = strtoull(status["voluntary_ctxt_switches"])
+	self.NonvoluntaryCtxtSwitches, _ = strtoull(status["nonvoluntary_ctxt_switches"])
+
+	self.TracerPid, _ = strconv.Atoi(status["TracerPid"])
+	self.NSpid = parseInts(status["NSpid"])
+	self.NStgid = parseInts(status["NStgid"])
+
+	self.SigPending, _ = strconv.ParseUint(status["SigPnd"], 16, 64)
+	self.SigBlocked, _ = strconv.ParseUint(status["SigBlk"], 16, 64)
+	self.SigIgnored, _ = strconv.ParseUint(status["SigIgn"], 16, 64)
+	self.SigCaught, _ = strconv.ParseUint(status["SigCgt"], 16, 64)
+
 	return nil
 }
 
+func newProcIDs(ids []string, lookup func(string) ProcID) ProcIDs {
+	return ProcIDs{
+		Real:      lookup(ids[0]),
+		Effective: lookup(ids[1]),
+		Saved:     lookup(ids[2]),
+		FS:        lookup(ids[3]),
+	}
+}
+
+// the ids of processes are usually the same, they are looked up once
+func (l *procLookups) user(uid string) ProcID {
+	return l.lookupID(uid, l.users, l.lookupUser)
+}
+
+func (l *procLookups) group(gid string) ProcID {
+	return l.lookupID(gid, l.groups, l.lookupGroup)
+}
+
+func (l *procLookups) lookupUser(uid string) string {
+	if l.etcRoot == "" {
+		return lookupUser(uid)
+	}
+	l.readEtc()
+	return l.userNames[uid]
+}
+
+func (l *procLookups) lookupGroup(gid string) string {
+	if l.etcRoot == "" {
+		return lookupGroup(gid)
+	}
+	l.readEtc()
+	return l.groupNames[gid]
+}
+
+func (l *procLookups) readEtc() {
+	l.etcOnce.Do(func() {
+		l.userNames = readIDNames(filepath.Join(l.etcRoot, "passwd"))
+		l.groupNames = readIDNames(filepath.Join(l.etcRoot, "group"))
+	})
+}
+
+// Reads the names by id of a passwd or group file, whose lines start with
+// name:password:id. A missing file has no names.
+func readIDNames(path string) map[string]string {
+	names := make(map[string]string)
+	readFile(path, func(line string) bool {
+		fields := strings.Split(line, ":")
+		if len(fields) >= 3 && fields[0] != "" && !strings.HasPrefix(fields[0], "#") {
+			if _, found := names[fields[2]]; !found {
+				names[fields[2]] = fields[0]
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// Returns the ProcID of id, the name being id itself if the lookup fails.
+func (l *procLookups) lookupID(id string, names map[string]ProcID, lookup func(string) string) ProcID {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if procID, found := names[id]; found {
+		return procID
+	}
+
+	procID := ProcID{Name: lookup(id)}
+	procID.ID, _ = strconv.Atoi(id)
+	if procID.Name == "" {
+		procID.Name = id
+	}
+
+	names[id] = procID
+	return procID
+}
+
+func lookupUser(uid string) string {
+	if user, err := user.LookupId(uid); err == nil {
+		return user.Username
+	}
+	return ""
+}
+
+func lookupGroup(gid string) string {
+	if group, err := user.LookupGroupId(gid); err == nil {
+		return group.Name
+	}
+	return ""
+}
+
+// Parses a list of integers separated by whitespace, e.g. NSpid.
+func parseInts(val string) []int {
+	var ints []int
+	for _, field := range strings.Fields(val) {
+		i, err := strconv.Atoi(field)
+		if err != nil {
+			return nil
+		}
+		ints = append(ints, i)
+	}
+	return ints
+}
+
 func (self *ProcMem) Get(pid int) error {
-	contents, err := readProcFile(pid, "statm")
+	return self.get(defaultSigar, pid)
+}
+
+func (self *ProcMem) get(s *ConcreteSigar, pid int) error {
+	contents, err := s.readProcFile(pid, "statm")
+	if err != nil {
+		return err
+	}
+
+	self.parseStatm(contents)
+
+	contents, err = s.readProcFile(pid, "stat")
 	if err != nil {
 		return err
 	}
 
+	self.parseStat(contents)
+
+	return nil
+}
+
+func (self *ProcMem) parseStatm(contents []byte) {
 	fields := strings.Fields(string(contents))
 
 	size, _ := strtoull(fields[0])
@@ -243,47 +478,96 @@ func (self *ProcMem) Get(pid int) error {
 
 	share, _ := strtoull(fields[2])
 	self.Share = share << 12
+}
 
-	contents, err = readProcFile(pid, "stat")
-	if err != nil {
-		return err
-	}
-
-	fields = strings.Fields(string(contents))
+func (self *ProcMem) parseStat(contents []byte) {
+	fields := splitStat(contents)
 
 	self.MinorFaults, _ = strtoull(fields[10])
 	self.MajorFaults, _ = strtoull(fields[12])
 	self.PageFaults = self.MinorFaults + self.MajorFaults
-
-	return nil
 }
 
 func (self *ProcTime) Get(pid int) error {
-	contents, err := readProcFile(pid, "stat")
+	return self.get(defaultSigar, pid)
+}
+
+func (self *ProcTime) get(s *ConcreteSigar, pid int) error {
+	contents, err := s.readProcFile(pid, "stat")
 	if err != nil {
 		return err
 	}
 
-	fields := strings.Fields(string(contents))
+	self.parseStat(s, contents)
+	self.getSchedstat(s, pid)
+
+	return nil
+}
+
+func (self *ProcTime) parseStat(s *ConcreteSigar, contents []byte) {
+	fields := splitStat(contents)
 
 	user, _ := strtoull(fields[13])
 	sys, _ := strtoull(fields[14])
+	self.UserNanos = ticksToNanos(user)
+	self.SysNanos = ticksToNanos(sys)
+
+	cuser, _ := strtoull(fields[15])
+	csys, _ := strtoull(fields[16])
+	self.ChildrenUserNanos = ticksToNanos(cuser)
+	self.ChildrenSysNanos = ticksToNanos(csys)
+
+	// added in Linux 2.6.18 and 2.6.24
+	if len(fields) > 43 {
+		blkio, _ := strtoull(fields[41])
+		guest, _ := strtoull(fields[42])
+		cguest, _ := strtoull(fields[43])
+		self.BlkioDelayNanos = ticksToNanos(blkio)
+		self.GuestNanos = ticksToNanos(guest)
+		self.ChildrenGuestNanos = ticksToNanos(cguest)
+	}
+
 	// convert to millis
-	self.User = user * (1000 / system.ticks)
-	self.Sys = sys * (1000 / system.ticks)
+	self.User = self.UserNanos / 1e6
+	self.Sys = self.SysNanos / 1e6
 	self.Total = self.User + self.Sys
+	self.ChildrenUser = self.ChildrenUserNanos / 1e6
+	self.ChildrenSys = self.ChildrenSysNanos / 1e6
 
-	// convert to millis
-	self.StartTime, _ = strtoull(fields[21])
-	self.StartTime /= system.ticks
-	self.StartTime += system.btime
-	self.StartTime *= 1000
+	// the boot time has a precision of seconds, StartTime keeps it
+	start, _ := strtoull(fields[21])
+	self.StartTimeNanos = s.bootTime()*1e9 + ticksToNanos(start)
+	self.StartTime = self.StartTimeNanos / 1e9 * 1000
+}
 
-	return nil
+// Reads /proc/[pid]/schedstat, which requires a kernel
+// built with CONFIG_SCHED_INFO. The times stay zero without it.
+func (self *ProcTime) getSchedstat(s *ConcreteSigar, pid int) {
+	contents, err := s.readProcFile(pid, "schedstat")
+	if err != nil {
+		return
+	}
+
+	fields := strings.Fields(string(contents))
+	if len(fields) < 3 {
+		return
+	}
+	self.RunNanos, _ = strtoull(fields[0])
+	self.RunDelayNanos, _ = strtoull(fields[1])
+	self.Timeslices, _ = strtoull(fields[2])
+}
+
+// Converts clock ticks to nanoseconds without overflowing.
+func ticksToNanos(ticks uint64) uint64 {
+	return ticks/system.ticks*1e9 + ticks%system.ticks*1e9/system.ticks
 }
 
 func (self *ProcArgs) Get(pid int) error {
-	contents, err := readProcFile(pid, "cmdline")
+	return self.get(defaultSigar, pid)
+}
+
+func (self *ProcArgs) get(s *ConcreteSigar, pid int) error {
+	contents, err := s.readProcFile(pid, "cmdline")
 	if err != nil {
 		return err
 	}
@@ -306,6 +590,10 @@ func (self *ProcArgs) Get(pid int) error {
 }
 
 func (self *ProcExe) Get(pid int) error {
+	return self.get(defaultSigar, pid)
+}
+
+func (self *ProcExe) get(s *ConcreteSigar, pid int) error {
 	fields := map[string]*string{
 		"exe":  &self.Name,
 		"cwd":  &self.Cwd,
@@ -313,7 +601,7 @@ func (self *ProcExe) Get(pid int) error {
 	}
 
 	for name, field := range fields {
-		val, err := os.Readlink(procFileName(pid, name))
+		val, err := os.Readlink(s.procFileName(pid, name))
 
 		if err != nil {
 			return err
@@ -325,8 +613,8 @@ func (self *ProcExe) Get(pid int) error {
 	return nil
 }
 
-func parseMeminfo(table map[string]*uint64) error {
-	return readFile(Procd+"/meminfo", func(line string) bool {
+func (s *ConcreteSigar) parseMeminfo(table map[string]*uint64) error {
+	return readFile(s.procd()+"/meminfo", func(line string) bool {
 		fields := strings.Split(line, ":")
 
 		if ptr := table[fields[0]]; ptr != nil {
@@ -362,16 +650,45 @@ func readFile(file string, handler func(string) bool) error {
 	return nil
 }
 
+// Splits the contents of /proc/[pid]/stat into fields, keeping the
+// command name in parentheses as one field even if it contains spaces.
+func splitStat(contents []byte) []string {
+	stat := string(contents)
+	start := strings.IndexByte(stat, '(')
+	end := strings.LastIndexByte(stat, ')')
+	if start < 0 || end < start {
+		return strings.Fields(stat)
+	}
+
+	fields := []string{strings.TrimSpace(stat[:start]), stat[start : end+1]}
+	return append(fields, strings.Fields(stat[end+1:])...)
+}
+
 func strtoull(val string) (uint64, error) {
 	return strconv.ParseUint(val, 10, 64)
 }
 
-func procFileName(pid int, name string) string {
-	return Procd + "/" + strconv.Itoa(pid) + "/" + name
+func (s *ConcreteSigar) procFileName(pid int, name string) string {
+	return s.procd() + "/" + strconv.Itoa(pid) + "/" + name
+}
+
+// Reports whether err shows that the process exited, its proc
+// files being missing or no longer readable.
+func isProcessGone(err error) bool {
+	if perr, ok := err.(*os.PathError); ok {
+		err = perr.Err
+	}
+	return err == syscall.ENOENT || err == syscall.ESRCH
+}
+
+// Reports whether the proc directory of pid exists.
+func (s *ConcreteSigar) processExists(pid int) bool {
+	_, err := os.Stat(filepath.Join(s.procd(), strconv.Itoa(pid)))
+	return !os.IsNotExist(err)
 }
 
-func readProcFile(pid int, name string) ([]byte, error) {
-	path := procFileName(pid, name)
+func (s *ConcreteSigar) readProcFile(pid int, name string) ([]byte, error) {
+	path := s.procFileName(pid, name)
 	contents, err := ioutil.ReadFile(path)
 
 	if err != nil {
@@ -387,9 +704,9 @@ func readProcFile(pid int, name string) ([]byte, error) {
 
 // getProcStatus reads /proc/[pid]/status which contains process status
 // information in human readable form.
-func getProcStatus(pid int) (map[string]string, error) {
+func (s *ConcreteSigar) getProcStatus(pid int) (map[string]string, error) {
 	status := make(map[string]string, 42)
-	path := filepath.Join(Procd, strconv.Itoa(pid), "status")
+	path := filepath.Join(s.procd(), strconv.Itoa(pid), "status")
 	err := readFile(path, func(line string) bool {
 		fields := strings.SplitN(line, ":", 2)
 		if len(fields) == 2 {
@@ -401,18 +718,102 @@ func getProcStatus(pid int) (map[string]string, error) {
 	return status, err
 }
 
-// getUIDs reads the "Uid" value from status and splits it into four values --
-// real, effective, saved set, and  file system UIDs.
-func getUIDs(status map[string]string) ([]string, error) {
-	uidLine, ok := status["Uid"]
+// getIDs reads the "Uid" or "Gid" value from status and splits it into four
+// values -- real, effective, saved set, and  file system IDs.
+func getIDs(status map[string]string, name string) ([]string, error) {
+	idLine, ok := status[name]
 	if !ok {
-		return nil, fmt.Errorf("Uid not found in proc status")
+		return nil, fmt.Errorf("%s not found in proc status", name)
+	}
+
+	idStrs := strings.Fields(idLine)
+	if len(idStrs) != 4 {
+		return nil, fmt.Errorf("%s line ('%s') did not contain four values", name, idLine)
+	}
+
+	return idStrs, nil
+}
+
+// Reads the fields of a process for GetProcessSnapshot, reading stat once
+// for the state, memory and time fields. Returns a nil Process if it
+// exited, and the first error reading the fields.
+func (s *ConcreteSigar) getProcess(pid int, fields ProcField, lookups *procLookups) (*Process, error) {
+	proc := &Process{Pid: pid}
+	var firstErr error
+	setErr := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if fields&(ProcFieldState|ProcFieldMem|ProcFieldTime) != 0 {
+		contents, err := s.readProcFile(pid, "stat")
+		if err != nil {
+			if err == syscall.ESRCH {
+				return nil, err
+			}
+			setErr(err)
+		} else {
+			if fields&ProcFieldState != 0 {
+				if err := proc.State.parseStat(s, pid, contents, lookups); err != nil {
+					setErr(err)
+				} else if err := proc.State.getStatus(s, pid, lookups); err != nil {
+					if err == syscall.ESRCH {
+						return nil, err
+					}
+					setErr(err)
+				}
+			}
+			if fields&ProcFieldMem != 0 {
+				proc.Mem.parseStat(contents)
+			}
+			if fields&ProcFieldTime != 0 {
+				proc.Time.parseStat(s, contents)
+				proc.Time.getSchedstat(s, pid)
+			}
+		}
+	}
+
+	if fields&ProcFieldMem != 0 {
+		contents, err := s.readProcFile(pid, "statm")
+		if err == syscall.ESRCH {
+			return nil, err
+		}
+		if err != nil {
+			setErr(err)
+		} else {
+			proc.Mem.parseStatm(contents)
+		}
+	}
+
+	if fields&ProcFieldArgs != 0 {
+		if err := proc.Args.get(s, pid); err != nil {
+			if err == syscall.ESRCH {
+				return nil, err
+			}
+			setErr(err)
+		}
+	}
+
+	// kernel threads have no executable, so a missing link is an error
+	// of the field rather than a sign that the process exited
+	if fields&ProcFieldExe != 0 {
+		if err := proc.Exe.get(s, pid); err != nil {
+			setErr(err)
+		}
+	}
+
+	if fields&ProcFieldFDUsage != 0 {
+		if err := proc.FDUsage.get(s, pid); err != nil {
+			setErr(err)
+		}
 	}
 
-	uidStrs := strings.Fields(uidLine)
-	if len(uidStrs) != 4 {
-		return nil, fmt.Errorf("Uid line ('%s') did not contain four values", uidLine)
+	// the errors of the fields read after the process exited are
+	// wrapped or specific to the field, check that it is still there
+	if firstErr != nil && !s.processExists(pid) {
+		return nil, syscall.ESRCH
 	}
 
-	return uidStrs, nil
+	return proc, firstErr
 }
@@ -1,16 +1,20 @@
 package gosigar_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
+	"syscall"
 	"testing"
 	"time"
 
 	sigar "github.com/elastic/gosigar"
+	"github.com/elastic/gosigar/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,6 +37,27 @@ func tearDown(t testing.TB) {
 	}
 }
 
+// writeProcRoot writes files, keyed by their path relative to the root, to a
+// new temporary proc root and returns the root.
+func writeProcRoot(t testing.TB, files map[string]string) string {
+	root, err := ioutil.TempDir("", "sigarProcRoot")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
 func TestLinuxProcState(t *testing.T) {
 	setUp(t)
 	defer tearDown(t)
@@ -40,6 +65,7 @@ func TestLinuxProcState(t *testing.T) {
 	var procNames = []string{
 		"cron",
 		"a very long process name",
+		"worker) R (1",
 	}
 
 	for _, n := range procNames {
@@ -70,10 +96,132 @@ func TestLinuxProcState(t *testing.T) {
 				assert.Equal(t, 2, state.Pgid)
 				assert.Equal(t, strconv.Itoa(uid), state.Username)
 			}
+
+			// the times assume 100 clock ticks per second
+			if util.GetClockTicks() != 100 {
+				return
+			}
+			procTime := sigar.ProcTime{}
+			if assert.NoError(t, procTime.Get(pid)) {
+				assert.Equal(t, uint64(110), procTime.User)
+				assert.Equal(t, uint64(120), procTime.Sys)
+				assert.Equal(t, uint64(130), procTime.ChildrenUser)
+				assert.Equal(t, uint64(140), procTime.ChildrenSys)
+			}
 		}()
 	}
 }
 
+func TestLinuxProcStateStatus(t *testing.T) {
+	// controlling terminal /dev/pts/5 and 3 threads
+	stat := "1234 (tmux: server) S 1 1234 1234 34821 1300 4194560 1 0 0 0 " +
+		"10 20 30 40 20 0 3 0 100 1000 200 18446744073709551615 " +
+		"1 1 0 0 0 0 0 0 0 0 0 0 17 2 0 0 0 0 0"
+	status := `Name:	tmux: server
+Tgid:	1234
+NStgid:	1234	7
+Pid:	1234
+PPid:	1
+TracerPid:	42
+Uid:	0	1	2	3
+Gid:	0	0	5	0
+Groups:	0 1
+NSpid:	1234	7
+Threads:	3
+SigPnd:	0000000000000100
+SigBlk:	0000000000010000
+SigIgn:	0000000000001000
+SigCgt:	0000000188014a07
+voluntary_ctxt_switches:	150
+nonvoluntary_ctxt_switches:	25
+`
+	root := writeProcRoot(t, map[string]string{
+		"1234/stat":   stat,
+		"1234/status": status,
+	})
+	defer os.RemoveAll(root)
+
+	state, err := sigar.NewSigar(sigar.Options{ProcRoot: root}).GetProcState(1234)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "tmux: server", state.Name)
+	assert.Equal(t, 1234, state.Sid)
+	assert.Equal(t, 34821, state.Tty)
+	assert.Equal(t, "/dev/pts/5", state.TtyName)
+	assert.Equal(t, 1300, state.Tpgid)
+	assert.Equal(t, 3, state.NumThreads)
+	assert.Equal(t, 2, state.Processor)
+
+	assert.Equal(t, 0, state.UIDs.Real.ID)
+	assert.Equal(t, 1, state.UIDs.Effective.ID)
+	assert.Equal(t, 2, state.UIDs.Saved.ID)
+	assert.Equal(t, 3, state.UIDs.FS.ID)
+	assert.Equal(t, state.UIDs.Real.Name, state.Username)
+	assert.NotEmpty(t, state.UIDs.FS.Name)
+	assert.Equal(t, 5, state.GIDs.Saved.ID)
+	if assert.Len(t, state.Groups, 2) {
+		assert.Equal(t, 1, state.Groups[1].ID)
+		assert.NotEmpty(t, state.Groups[1].Name)
+	}
+
+	assert.Equal(t, uint64(150), state.VoluntaryCtxtSwitches)
+	assert.Equal(t, uint64(25), state.NonvoluntaryCtxtSwitches)
+	assert.Equal(t, 42, state.TracerPid)
+	assert.Equal(t, []int{1234, 7}, state.NSpid)
+	assert.Equal(t, []int{1234, 7}, state.NStgid)
+
+	assert.Equal(t, uint64(1)<<(9-1), state.SigPending) // SIGKILL
+	assert.Equal(t, uint64(0x10000), state.SigBlocked)
+	assert.Equal(t, uint64(0x1000), state.SigIgnored)
+	assert.Equal(t, uint64(0x188014a07), state.SigCaught)
+}
+
+func TestLinuxProcTime(t *testing.T) {
+	if util.GetClockTicks() != 100 {
+		t.Skip("the test assumes 100 clock ticks per second")
+	}
+
+	// utime 150, stime 25, cutime 7, cstime 3, starttime 1234,
+	// delayacct_blkio_ticks 9, guest_time 40, cguest_time 2
+	stat := "1234 (qemu system) S 1 1234 1234 0 -1 4194560 1 0 0 0 " +
+		"150 25 7 3 20 0 3 0 1234 1000 200 18446744073709551615 " +
+		"1 1 0 0 0 0 0 0 0 0 0 0 17 2 0 0 9 40 2 0 0 0 0 0 0 0"
+	root := writeProcRoot(t, map[string]string{
+		"stat":           "cpu 1 2 3 4\nbtime 1500000000\n",
+		"1234/stat":      stat,
+		"1234/schedstat": "123456789 987654 42\n",
+	})
+	defer os.RemoveAll(root)
+
+	procTime, err := sigar.NewSigar(sigar.Options{ProcRoot: root}).GetProcTime(1234)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tick := uint64(10 * time.Millisecond)
+	assert.Equal(t, sigar.ProcTime{
+		StartTime:          1500000000*1000 + 12000,
+		User:               1500,
+		Sys:                250,
+		Total:              1750,
+		ChildrenUser:       70,
+		ChildrenSys:        30,
+		StartTimeNanos:     1500000000*1e9 + 1234*tick,
+		UserNanos:          150 * tick,
+		SysNanos:           25 * tick,
+		ChildrenUserNanos:  7 * tick,
+		ChildrenSysNanos:   3 * tick,
+		GuestNanos:         40 * tick,
+		ChildrenGuestNanos: 2 * tick,
+		BlkioDelayNanos:    9 * tick,
+		RunNanos:           123456789,
+		RunDelayNanos:      987654,
+		Timeslices:         42,
+	}, procTime)
+}
+
 func TestLinuxCPU(t *testing.T) {
 	setUp(t)
 	defer tearDown(t)
@@ -150,6 +298,68 @@ func TestLinuxCollectCpuStats(t *testing.T) {
 	stop <- struct{}{}
 }
 
+func TestLinuxCollectCpuStatsContext(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	statFile := procd + "/stat"
+	writeStat := func(contents string) {
+		if err := ioutil.WriteFile(statFile, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeStat("cpu 25 1 2 3 4 5 6 7\ncpu0 20 1 1 1 1 1 1 1\ncpu1 5 0 1 2 3 4 5 6\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	concreteSigar := &sigar.ConcreteSigar{}
+	samples := concreteSigar.CollectCpuStatsContext(ctx, 100*time.Millisecond,
+		sigar.CollectCpuStatsOptions{PerCPU: true, Block: true})
+
+	first := <-samples
+	if assert.NoError(t, first.Err) {
+		assert.Equal(t, uint64(25), first.Delta.User)
+		assert.Equal(t, time.Duration(0), first.Elapsed)
+		assert.Len(t, first.PerCPU, 2)
+	}
+
+	// the next sample is read after the interval
+	writeStat("cpu 30 1 2 3 4 5 6 7\ncpu0 21 1 1 1 1 1 1 1\ncpu1 9 0 1 2 3 4 5 6\n")
+
+	second := <-samples
+	if assert.NoError(t, second.Err) {
+		assert.Equal(t, uint64(5), second.Delta.User)
+		assert.Equal(t, second.Time.Sub(first.Time), second.Elapsed)
+		if assert.Len(t, second.PerCPU, 2) {
+			assert.Equal(t, uint64(1), second.PerCPU[0].User)
+			assert.Equal(t, uint64(4), second.PerCPU[1].User)
+		}
+	}
+
+	os.Remove(statFile)
+	third := <-samples
+	assert.Error(t, third.Err)
+
+	// a CPU was brought online
+	writeStat("cpu 40 1 2 3 4 5 6 7\ncpu0 22 1 1 1 1 1 1 1\ncpu1 10 0 1 2 3 4 5 6\ncpu2 8 0 0 0 0 0 0 0\n")
+
+	fourth := <-samples
+	if assert.NoError(t, fourth.Err) {
+		assert.Equal(t, uint64(10), fourth.Delta.User)
+		assert.Nil(t, fourth.PerCPU)
+	}
+
+	writeStat("cpu 43 1 2 3 4 5 6 7\ncpu0 23 1 1 1 1 1 1 1\ncpu1 11 0 1 2 3 4 5 6\ncpu2 9 0 0 0 0 0 0 0\n")
+
+	fifth := <-samples
+	if assert.NoError(t, fifth.Err) && assert.Len(t, fifth.PerCPU, 3) {
+		assert.Equal(t, uint64(1), fifth.PerCPU[2].User)
+	}
+
+	cancel()
+	for range samples {
+	}
+}
+
 func TestLinuxMemAndSwap(t *testing.T) {
 	setUp(t)
 	defer tearDown(t)
@@ -244,6 +454,74 @@ func TestFDUsage(t *testing.T) {
 	}
 }
 
+func TestNewSigarRoots(t *testing.T) {
+	root := writeProcRoot(t, map[string]string{
+		"loadavg":        "0.25 0.50 0.75 1/100 1000",
+		"meminfo":        "MemTotal: 2048 kB\nMemFree: 1024 kB\nSwapTotal: 512 kB\nSwapFree: 256 kB\n",
+		"sys/fs/file-nr": "10 0 100",
+	})
+	defer os.RemoveAll(root)
+
+	s := sigar.NewSigar(sigar.Options{ProcRoot: root})
+
+	load, err := s.GetLoadAverage()
+	if assert.NoError(t, err) {
+		assert.Equal(t, sigar.LoadAverage{One: 0.25, Five: 0.5, Fifteen: 0.75}, load)
+	}
+
+	mem, err := s.GetMem()
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(2048*1024), mem.Total)
+		assert.Equal(t, uint64(1024*1024), mem.Free)
+	}
+
+	swap, err := s.GetSwap()
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(256*1024), swap.Used)
+	}
+
+	fd, err := s.GetFDUsage()
+	if assert.NoError(t, err) {
+		assert.Equal(t, sigar.FDUsage{Open: 10, Unused: 0, Max: 100}, fd)
+	}
+
+	// the globals and the default instance are not changed
+	assert.Equal(t, "/proc", sigar.Procd)
+	mem, err = (&sigar.ConcreteSigar{}).GetMem()
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, uint64(2048*1024), mem.Total)
+	}
+}
+
+func TestProcStateEtcRoot(t *testing.T) {
+	root := writeProcRoot(t, map[string]string{
+		"proc/100/stat":   pidStats(100, "etc"),
+		"proc/100/status": pidStatus("etc", 100, 1000),
+		"etc/passwd":      "# comment\nroot:x:0:0:root:/root:/bin/sh\nalice:x:1000:100::/home/alice:/bin/sh\n",
+		"etc/group":       "root:x:0:\nusers:x:100:alice\naudio:x:16:alice\n",
+	})
+	defer os.RemoveAll(root)
+
+	s := sigar.NewSigar(sigar.Options{
+		ProcRoot: filepath.Join(root, "proc"),
+		EtcRoot:  filepath.Join(root, "etc"),
+	})
+	state, err := s.GetProcState(100)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "alice", state.Username)
+	assert.Equal(t, sigar.ProcID{ID: 1000, Name: "alice"}, state.UIDs.Real)
+	assert.Equal(t, sigar.ProcID{ID: 100, Name: "users"}, state.GIDs.Real)
+	// gid 14 has no name in the group file
+	assert.Equal(t, []sigar.ProcID{
+		{ID: 100, Name: "users"},
+		{ID: 14, Name: "14"},
+		{ID: 16, Name: "audio"},
+	}, state.Groups)
+}
+
 func TestProcFDUsage(t *testing.T) {
 	setUp(t)
 	defer tearDown(t)
@@ -301,6 +579,158 @@ Max realtime timeout      unlimited            unlimited            us
 	}
 }
 
+func TestProcIO(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	io := "rchar: 1024\nwchar: 2048\nsyscr: 10\nsyscw: 20\n" +
+		"read_bytes: 4096\nwrite_bytes: 8192\ncancelled_write_bytes: 512\n"
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "io"), []byte(io), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	procIO := sigar.ProcIO{}
+	if assert.NoError(t, procIO.Get(pid)) {
+		assert.Equal(t, sigar.ProcIO{
+			ReadChar:            1024,
+			WriteChar:           2048,
+			ReadSyscalls:        10,
+			WriteSyscalls:       20,
+			ReadBytes:           4096,
+			WriteBytes:          8192,
+			CancelledWriteBytes: 512,
+		}, procIO)
+	}
+
+	assert.Equal(t, syscall.ESRCH, procIO.Get(pid+1))
+}
+
+func TestProcSched(t *testing.T) {
+	// the syscalls read this process
+	sched, err := sigar.NewSigar(sigar.Options{}).GetProcSched(os.Getpid())
+	if assert.NoError(t, err) {
+		assert.Equal(t, sigar.SchedOther, sched.Policy)
+		assert.Equal(t, "SCHED_OTHER", sched.Policy.String())
+		assert.Equal(t, 0, sched.RtPriority)
+		assert.Len(t, sched.Affinity, runtime.NumCPU())
+		assert.True(t, sched.IOPrioLevel >= 0 && sched.IOPrioLevel <= 7)
+	}
+
+	err = (&sigar.ProcSched{}).Get(1 << 22)
+	assert.Equal(t, syscall.ESRCH, err)
+
+	// with a proc root all the settings are read from its files,
+	// here of a SCHED_FIFO process with realtime priority 10
+	stat := "1234 (irq worker) S 2 0 0 0 -1 2129984 0 0 0 0 " +
+		"0 5 0 0 -51 0 1 0 30 0 0 18446744073709551615 " +
+		"0 0 0 0 0 0 0 2147483647 0 0 0 0 17 3 10 1 0 0 0"
+	root := writeProcRoot(t, map[string]string{
+		"1234/stat":      stat,
+		"1234/status":    "Name:\tirq worker\nCpus_allowed_list:\t2-3\nMems_allowed:\t00000000,00000003\nMems_allowed_list:\t0-1\n",
+		"1234/numa_maps": "00400000 interleave:0-1 file=/usr/bin/test mapped=1 N0=1\n00e9c000 bind:1 anon=12 N1=12\n",
+		"1234/autogroup": "/autogroup-42 nice 5\n",
+	})
+	defer os.RemoveAll(root)
+
+	sched, err = sigar.NewSigar(sigar.Options{ProcRoot: root}).GetProcSched(1234)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, sigar.ProcSched{
+		Policy:        sigar.SchedFIFO,
+		RtPriority:    10,
+		Affinity:      []int{2, 3},
+		MemPolicy:     "interleave:0-1",
+		MemsAllowed:   []int{0, 1},
+		AutogroupID:   42,
+		AutogroupNice: 5,
+	}, sched)
+
+	_, err = sigar.NewSigar(sigar.Options{ProcRoot: root}).GetProcSched(4321)
+	assert.Equal(t, syscall.ESRCH, err)
+}
+
+func TestProcLimits(t *testing.T) {
+	limits := `Limit                     Soft Limit           Hard Limit           Units     
+Max cpu time              unlimited            unlimited            seconds   
+Max file size             unlimited            unlimited            bytes     
+Max data size             unlimited            unlimited            bytes     
+Max stack size            8388608              unlimited            bytes     
+Max core file size        0                    unlimited            bytes     
+Max resident set          unlimited            unlimited            bytes     
+Max processes             63704                63704                processes 
+Max open files            1024                 1048576              files     
+Max locked memory         8388608              8388608              bytes     
+Max address space         unlimited            unlimited            bytes     
+Max file locks            unlimited            unlimited            locks     
+Max pending signals       63704                63704                signals   
+Max msgqueue size         819200               819200               bytes     
+Max nice priority         0                    0                    
+Max realtime priority     0                    0                    
+Max realtime timeout      unlimited            unlimited            us        
+`
+	root := writeProcRoot(t, map[string]string{"1234/limits": limits})
+	defer os.RemoveAll(root)
+
+	procLimits, err := sigar.NewSigar(sigar.Options{ProcRoot: root}).GetProcLimits(1234)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	unlimited := sigar.Rlimit{Soft: sigar.RlimitInfinity, Hard: sigar.RlimitInfinity}
+	assert.Equal(t, unlimited, procLimits.CPU)
+	assert.Equal(t, sigar.Rlimit{Soft: 8388608, Hard: sigar.RlimitInfinity}, procLimits.Stack)
+	assert.Equal(t, sigar.Rlimit{Soft: 0, Hard: sigar.RlimitInfinity}, procLimits.Core)
+	assert.Equal(t, sigar.Rlimit{Soft: 1024, Hard: 1048576}, procLimits.OpenFiles)
+	assert.Equal(t, sigar.Rlimit{Soft: 819200, Hard: 819200}, procLimits.MsgqueueSize)
+	assert.Equal(t, sigar.Rlimit{}, procLimits.RealtimePriority)
+	assert.Equal(t, unlimited, procLimits.RealtimeTimeout)
+	assert.Equal(t, procLimits.OpenFiles, procLimits.Limit(sigar.RlimitOpenFiles))
+	assert.Equal(t, "files", sigar.RlimitOpenFiles.Unit())
+	assert.Equal(t, "Max open files", sigar.RlimitOpenFiles.String())
+}
+
+func TestSetProcLimit(t *testing.T) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		t.Fatal(err)
+	}
+	if rlimit.Cur < 2 {
+		t.Skip("the open files limit is too low")
+	}
+
+	procLimits := sigar.ProcLimits{}
+	if assert.NoError(t, procLimits.Get(os.Getpid())) {
+		assert.Equal(t, sigar.Rlimit{Soft: rlimit.Cur, Hard: rlimit.Max}, procLimits.OpenFiles)
+	}
+
+	// the limits file names the resources, checking the numbers of this
+	// architecture passed to prlimit()
+	fileLimits, err := sigar.NewSigar(sigar.Options{ProcRoot: "/proc"}).GetProcLimits(os.Getpid())
+	if assert.NoError(t, err) {
+		assert.Equal(t, fileLimits, procLimits)
+	}
+
+	lowered := sigar.Rlimit{Soft: rlimit.Cur - 1, Hard: rlimit.Max}
+	if !assert.NoError(t, sigar.SetProcLimit(os.Getpid(), sigar.RlimitOpenFiles, lowered)) {
+		return
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlimit)
+
+	if assert.NoError(t, procLimits.Get(os.Getpid())) {
+		assert.Equal(t, lowered, procLimits.OpenFiles)
+	}
+
+	assert.Equal(t, syscall.ESRCH, sigar.SetProcLimit(1<<22, sigar.RlimitOpenFiles, lowered))
+	assert.Equal(t, syscall.EINVAL, sigar.SetProcLimit(os.Getpid(), sigar.RlimitResource(16), lowered))
+}
+
 func writeFDs(pid int, count int) error {
 	fdDir := fmt.Sprintf("%s/%d/fd", procd, pid)
 	err := os.Mkdir(fdDir, 0755)
@@ -320,15 +750,22 @@ func writeFDs(pid int, count int) error {
 }
 
 func writePidStats(pid int, procName string, path string) error {
+	return ioutil.WriteFile(path, []byte(pidStats(pid, procName)), 0644)
+}
+
+func pidStats(pid int, procName string) string {
 	stats := "S 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 " +
 		"20 21 22 23 24 25 26 27 28 29 30 31 32 33 34 " +
 		"35 36 37 38 39"
 
-	statContents := []byte(fmt.Sprintf("%d (%s) %s", pid, procName, stats))
-	return ioutil.WriteFile(path, statContents, 0644)
+	return fmt.Sprintf("%d (%s) %s", pid, procName, stats)
 }
 
 func writePidStatus(name string, pid int, uid int, pidStatusFile string) error {
+	return ioutil.WriteFile(pidStatusFile, []byte(pidStatus(name, pid, uid)), 0644)
+}
+
+func pidStatus(name string, pid int, uid int) string {
 	status := `
 Name:   %s
 State:  R (running)
@@ -370,6 +807,35 @@ Seccomp:        0
 voluntary_ctxt_switches:        0
 nonvoluntary_ctxt_switches:     1`
 
-	statusContents := []byte(fmt.Sprintf(status, name, pid, uid))
-	return ioutil.WriteFile(pidStatusFile, statusContents, 0644)
+	return fmt.Sprintf(status, name, pid, uid)
+}
+
+func TestProcessSnapshotVanished(t *testing.T) {
+	// pid 200 is listed but has no proc files, as if it exited, and
+	// pid 300 exited after its stat file was read
+	root := writeProcRoot(t, map[string]string{
+		"100/stat":   pidStats(100, "snapshot"),
+		"100/status": pidStatus("snapshot", 100, 0),
+		"300/stat":   pidStats(300, "exited"),
+	})
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "200"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := sigar.NewSigar(sigar.Options{ProcRoot: root})
+	snapshot, err := s.GetProcessSnapshot(sigar.ProcessSnapshotOptions{
+		Fields: sigar.ProcFieldState,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if assert.Len(t, snapshot.Processes, 1) {
+		proc := snapshot.Processes[0]
+		assert.Equal(t, 100, proc.Pid)
+		assert.Equal(t, "snapshot", proc.State.Name)
+		assert.Equal(t, 1, proc.State.Ppid)
+	}
+	assert.Equal(t, map[int]error{200: syscall.ESRCH, 300: syscall.ESRCH}, snapshot.Errors)
 }
@@ -377,6 +377,22 @@ func (self *ProcFDUsage) Get(pid int) error {
 	return ErrNotImplemented{runtime.GOOS}
 }
 
+func (self *ProcIO) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcSched) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcLimits) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func SetProcLimit(pid int, resource RlimitResource, limit Rlimit) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
 func fillCpu(cpu *Cpu, load [C.CPUSTATES]C.long) {
 	cpu.User = uint64(load[0])
 	cpu.Nice = uint64(load[1])
@@ -0,0 +1,78 @@
+// +build !freebsd,!linux
+
+package gosigar
+
+// The filesystem roots of a ConcreteSigar are only used on Linux,
+// other platforms read the host with the Get methods.
+
+func (self *LoadAverage) get(s *ConcreteSigar) error {
+	return self.Get()
+}
+
+func (self *Mem) get(s *ConcreteSigar) error {
+	return self.Get()
+}
+
+func (self *Swap) get(s *ConcreteSigar) error {
+	return self.Get()
+}
+
+func (self *Cpu) get(s *ConcreteSigar) error {
+	return self.Get()
+}
+
+func (self *FDUsage) get(s *ConcreteSigar) error {
+	return self.Get()
+}
+
+func (self *CpuList) get(s *ConcreteSigar) error {
+	return self.Get()
+}
+
+func (self *Uptime) get(s *ConcreteSigar) error {
+	return self.Get()
+}
+
+func (self *FileSystemList) get(s *ConcreteSigar) error {
+	return self.Get()
+}
+
+func (self *ProcList) get(s *ConcreteSigar) error {
+	return self.Get()
+}
+
+func (self *ProcState) get(s *ConcreteSigar, pid int) error {
+	return self.Get(pid)
+}
+
+func (self *ProcMem) get(s *ConcreteSigar, pid int) error {
+	return self.Get(pid)
+}
+
+func (self *ProcTime) get(s *ConcreteSigar, pid int) error {
+	return self.Get(pid)
+}
+
+func (self *ProcArgs) get(s *ConcreteSigar, pid int) error {
+	return self.Get(pid)
+}
+
+func (self *ProcExe) get(s *ConcreteSigar, pid int) error {
+	return self.Get(pid)
+}
+
+func (self *ProcFDUsage) get(s *ConcreteSigar, pid int) error {
+	return self.Get(pid)
+}
+
+func (self *ProcIO) get(s *ConcreteSigar, pid int) error {
+	return self.Get(pid)
+}
+
+func (self *ProcSched) get(s *ConcreteSigar, pid int) error {
+	return self.Get(pid)
+}
+
+func (self *ProcLimits) get(s *ConcreteSigar, pid int) error {
+	return self.Get(pid)
+}
@@ -475,6 +475,22 @@ func (self *ProcFDUsage) Get(pid int) error {
 	return ErrNotImplemented{runtime.GOOS}
 }
 
+func (self *ProcIO) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcSched) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcLimits) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func SetProcLimit(pid int, resource RlimitResource, limit Rlimit) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
 func (self *FileSystemUsage) Get(path string) error {
 
 	/*
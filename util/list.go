@@ -0,0 +1,46 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseList reads a list of integers written in the kernel's list format
+// where values are separated by commas and ranges are written with a dash
+// (e.g. "0-3,8,10-11"), as in cpuset.cpus or /proc/[pid]/status.
+// Whitespace surrounding the list is ignored.
+func ParseList(value string) ([]int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	var list []int
+	for _, item := range strings.Split(value, ",") {
+		bounds := strings.SplitN(item, "-", 2)
+
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid list item %q: %v", item, err)
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid list item %q: %v", item, err)
+			}
+		}
+
+		if last < first {
+			return nil, fmt.Errorf("invalid list item %q: range end is less than start", item)
+		}
+
+		for i := first; i <= last; i++ {
+			list = append(list, i)
+		}
+	}
+
+	return list, nil
+}
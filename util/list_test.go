@@ -0,0 +1,31 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		value string
+		list  []int
+	}{
+		{"", nil},
+		{"0\n", []int{0}},
+		{"0-3", []int{0, 1, 2, 3}},
+		{"0-1,4,6-7", []int{0, 1, 4, 6, 7}},
+	}
+
+	for _, test := range tests {
+		list, err := ParseList(test.value)
+		if assert.NoError(t, err, "value=%q", test.value) {
+			assert.Equal(t, test.list, list, "value=%q", test.value)
+		}
+	}
+
+	for _, value := range []string{"a", "1-", "3-1"} {
+		_, err := ParseList(value)
+		assert.Error(t, err, "value=%q", value)
+	}
+}